@@ -1,13 +1,120 @@
 /*
 a ball of the clock
+
+Balls are generic over the type of their ID, so that small clocks can use
+small IDs and big clocks big ones.  Ball is a ball with a uint8 ID, which is
+enough for the classic clock.
+
+A ball is no more than its ID, so that ball holders stay small and fast.
+What else is known about a ball, its lift count and attributes, is kept by
+ID by whatever tracks it, like the clock, and handed out as a Tracked ball.
 */
 package ball
 
-type Ball struct {
+import (
+	"fmt"
+	"strconv"
+)
+
+// The types a ball ID can be
+type ID interface {
+	~uint8 | ~uint16 | ~uint32
+}
+
+// A ball with an ID of type T
+type Of[T ID] struct {
+	// The original position of the ball in a ball holder
+	Id T
+}
+
+type Ball = Of[uint8]
+
+// A ball with an ID of type T, with what is known about it
+type Tracked[T ID] struct {
 	// The original position of the ball in a ball holder
-	Id uint8
+	Id T
+	// The number of times the ball has been lifted from the queue
+	Lifts uint64
+	// What the ball is like, for modelling physical clocks.  nil if nothing
+	// is known.  Attributes are shared by copies of a ball, so they should
+	// not be changed once the ball is in a clock.
+	Attrs *Attributes
+}
+
+// What a real-world ball is like
+type Attributes struct {
+	// A name to show for the ball rather than its ID
+	Label string `json:"label,omitempty"`
+	// A CSS colour, e.g., "steelblue" or "#4682b4"
+	Colour string `json:"colour,omitempty"`
+	// E.g., "steel" or "glass"
+	Material string `json:"material,omitempty"`
+	// In grams
+	Weight float64 `json:"weight,omitempty"`
 }
 
 func New(id uint8) Ball {
-	return Ball{id}
+	return NewOf(id)
+}
+
+// Create a ball with an ID of any type
+func NewOf[T ID](id T) Of[T] {
+	return Of[T]{Id: id}
+}
+
+// Create a tracked ball with the given attributes, not yet lifted
+func NewWithAttributes(id uint8, attrs Attributes) Tracked[uint8] {
+	return Tracked[uint8]{Id: id}.WithAttributes(attrs)
+}
+
+// Return a copy of the ball with the given attributes
+func (b Tracked[T]) WithAttributes(attrs Attributes) Tracked[T] {
+	b.Attrs = &attrs
+	return b
+}
+
+// Return the ball's label, or its ID if it has none
+func (b Tracked[T]) Label() string {
+	if b.Attrs != nil && b.Attrs.Label != "" {
+		return b.Attrs.Label
+	}
+	return fmt.Sprint(b.Id)
+}
+
+// Return the ball itself, without what is known about it
+func (b Tracked[T]) Ball() Of[T] {
+	return NewOf(b.Id)
+}
+
+// Return a copy of b with its ID converted to type U
+func Convert[U ID, T ID](b Of[T]) Of[U] {
+	return Of[U]{U(b.Id)}
+}
+
+// Marshal the ball as its ID, which is how ball clock states list balls
+func (b Of[T]) MarshalText() ([]byte, error) {
+	return strconv.AppendUint(nil, uint64(b.Id), 10), nil
+}
+
+// Set the ball to a new ball with the ID in text
+func (b *Of[T]) UnmarshalText(text []byte) error {
+	id, err := strconv.ParseUint(string(text), 10, 32)
+	if err != nil || uint64(T(id)) != id {
+		return fmt.Errorf("Malformed ball ID (%q)", text)
+	}
+	*b = NewOf(T(id))
+	return nil
+}
+
+// Marshal the ball as its ID, a JSON number
+func (b Of[T]) MarshalJSON() ([]byte, error) {
+	return b.MarshalText()
+}
+
+// Set the ball to a new ball with the ID in data, a JSON number
+func (b *Of[T]) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	return b.UnmarshalText(data)
 }
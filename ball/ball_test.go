@@ -1,7 +1,9 @@
 package ball
 
 import (
+	"encoding/json"
 	"testing"
+	"unsafe"
 )
 
 func TestNewBall(t *testing.T) {
@@ -11,3 +13,62 @@ func TestNewBall(t *testing.T) {
 		t.Errorf("Unexpected ball ID (Actual: %d, Expected: %d)\n", ball.Id, BALL_ID)
 	}
 }
+
+func TestAttributes(t *testing.T) {
+	b := Tracked[uint8]{Id: 3}
+	if b.Label() != "3" {
+		t.Errorf("Unexpected label (actual %s, expected %s)", b.Label(), "3")
+	}
+	b = NewWithAttributes(3, Attributes{Label: "chipped", Colour: "red", Material: "steel", Weight: 28.2})
+	if b.Label() != "chipped" || b.Attrs.Weight != 28.2 {
+		t.Errorf("Unexpected ball: %+v", b.Attrs)
+	}
+	// copies share attributes
+	c := b
+	c.Lifts++
+	if c.Attrs != b.Attrs || b.Lifts != 0 {
+		t.Errorf("Unexpected copy: %+v", c)
+	}
+}
+
+func TestOf(t *testing.T) {
+	b := Tracked[uint32]{Id: 70000}.WithAttributes(Attributes{Label: "big"})
+	if b.Id != 70000 || b.Label() != "big" || b.Ball() != NewOf(uint32(70000)) {
+		t.Errorf("Unexpected ball: %+v", b)
+	}
+	small := Convert[uint8](NewOf(uint16(200)))
+	if small.Id != 200 {
+		t.Errorf("Unexpected converted ball: %+v", small)
+	}
+	// a ball is only as big as its ID
+	if size := unsafe.Sizeof(small); size != 1 {
+		t.Errorf("Unexpected size of a uint8 ball (actual %d, expected 1)", size)
+	}
+	if size := unsafe.Sizeof(NewOf(uint16(0))); size != 2 {
+		t.Errorf("Unexpected size of a uint16 ball (actual %d, expected 2)", size)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	b := New(42)
+	if text, err := b.MarshalText(); err != nil || string(text) != "42" {
+		t.Errorf("Unexpected text %q (error %v)", text, err)
+	}
+	if data, err := json.Marshal([]Ball{b, New(0)}); err != nil || string(data) != "[42,0]" {
+		t.Errorf("Unexpected JSON %s (error %v)", data, err)
+	}
+
+	var balls []Of[uint16]
+	if err := json.Unmarshal([]byte("[300, 7]"), &balls); err != nil || len(balls) != 2 || balls[0].Id != 300 || balls[1].Id != 7 {
+		t.Errorf("Unexpected balls %v (error %v)", balls, err)
+	}
+	for _, text := range []string{"256", "-1", "x", "", `"4"`, "1.5"} {
+		var b Ball
+		if err := json.Unmarshal([]byte(text), &b); err == nil {
+			t.Errorf("Expected an error for %q, got ball %d", text, b.Id)
+		}
+	}
+	if err := b.UnmarshalText([]byte("9")); err != nil || b.Id != 9 {
+		t.Errorf("Unexpected ball %+v (error %v)", b, err)
+	}
+}
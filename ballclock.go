@@ -7,31 +7,156 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/bgmerrell/goballclock/clock"
+	"github.com/bgmerrell/goballclock/jobs"
+	"github.com/bgmerrell/goballclock/render"
 	"os"
 	"path"
 	"strconv"
+	"time"
 )
 
 const NARGS = 0
-const MAXBALLS = 127
-const MINBALLS = 27
 const END_OF_INPUT_VAL = 0
 
+var progressInterval = flag.Duration("progress", 0,
+	"report progress on stderr at this interval while computing (0 disables)")
+var timeout = flag.Duration("timeout", 0,
+	"give up on a ball count after this long (0 waits forever)")
+var debug = flag.Bool("debug", false,
+	"check the clock's invariants after every minute while computing (slow)")
+var renderFormat = flag.String("render", "",
+	"instead of reading stdin, draw a clock to stdout in this format (svg or gif)")
+var renderBalls = flag.Uint64("balls", clock.MIN_BALLS, "number of balls in the clock drawn by -render")
+var renderAfter = flag.Uint64("after", 0, "minutes to run the clock drawn by -render")
+var renderColor = flag.Bool("color", false, "colour the balls drawn by -render by ID")
+var gifMinutes = flag.Uint64("minutes", 60, "minutes of animation for -render gif")
+var gifFPS = flag.Int("fps", render.DEFAULT_GIF_FPS, "frames per second for -render gif")
+var gifPerTip = flag.Bool("per-tip", false, "for -render gif, only record a frame when a rail tips")
+var gifHighlight = flag.Bool("highlight", false, "for -render gif, ring the ball which tips a rail")
+
+// Computations for stdin input run one at a time, in input order
+var jobManager = jobs.NewManager(1, time.Minute)
+
+// Alternative modes, selected by the first command line argument.  Each
+// mode parses its own arguments.
+var modes = map[string]func(args []string) error{
+	"elapsed": elapsed,
+	"live":    live,
+	"plot":    plot,
+	"repl":    runRepl,
+	"report":  writeReport,
+	"serve":   serve,
+	"set":     setClock,
+	"trace":   trace,
+	"watch":   watch,
+}
+
 func usage() {
 	name := path.Base(os.Args[0])
-	msg := fmt.Sprintf("Usage: %s\n\n"+
-		"%s takes no arguments and accepts input from stdin.\n", name, name)
-	fmt.Fprintf(os.Stderr, msg)
+	msg := fmt.Sprintf("Usage: %s [mode [mode arguments]]\n\n"+
+		"Without a mode, %s accepts input from stdin.\n\n"+
+		"Modes:\n"+
+		"  elapsed\twork out how long a clock ran from its state (see %s elapsed -h)\n"+
+		"  live\trun a clock in step with the wall clock (see %s live -h)\n"+
+		"  plot\tchart days until cycle across ball counts (see %s plot -h)\n"+
+		"  repl\texplore a clock interactively (see %s repl -h)\n"+
+		"  report\twrite an HTML report on a range of ball counts (see %s report -h)\n"+
+		"  serve\tserve the HTTP JSON API (see %s serve -h)\n"+
+		"  set\tprint the state of a clock set to a time of day (see %s set -h)\n"+
+		"  trace\tfollow one ball through a clock run (see %s trace -h)\n"+
+		"  watch\tanimate a clock in the terminal (see %s watch -h)\n\n"+
+		"Options:\n", name, name, name, name, name, name, name, name, name, name, name)
+	fmt.Fprint(os.Stderr, msg)
+	flag.PrintDefaults()
+}
+
+// Compute the days until nBalls balls cycle as a background job, reporting
+// its progress on stderr if requested and giving up after the timeout
+func computeDays(nBalls uint8) (uint64, error) {
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	var tick <-chan time.Time
+	if *progressInterval > 0 {
+		ticker := time.NewTicker(*progressInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	job := jobs.Cycle(nBalls)
+	if *debug {
+		job = jobs.CycleChecked(nBalls)
+	}
+	id := jobManager.Submit(job)
+	done := make(chan jobs.Job, 1)
+	go func() {
+		j, _ := jobManager.Wait(context.Background(), id)
+		done <- j
+	}()
+	for {
+		select {
+		case <-tick:
+			if j, ok := jobManager.Get(id); ok {
+				fmt.Fprintf(os.Stderr, "%d balls: %d minutes simulated, %d refreshes\n",
+					nBalls, j.Progress.Minutes, j.Progress.Refreshes)
+			}
+			continue
+		case <-ctx.Done():
+			jobManager.Cancel(id)
+			<-done
+			return 0, fmt.Errorf("Timed out computing %d balls (after %s)", nBalls, *timeout)
+		case j := <-done:
+			if j.Status != jobs.DONE {
+				return 0, errors.New(j.Error)
+			}
+			return j.Result.(jobs.CycleResult).Days, nil
+		}
+	}
 }
 
 func parseCommandLine() {
 	flag.Parse()
 }
 
+// Draw a clock after running it for some minutes, or animate a run of it, as
+// requested by the -render flags
+func renderClock(file *os.File) error {
+	if err := clock.CheckBallCount(*renderBalls); err != nil {
+		msg := fmt.Sprintf("Malformed input (%s)", err.Error())
+		fmt.Fprintln(os.Stderr, msg)
+		return errors.New(msg)
+	}
+	var err error
+	switch *renderFormat {
+	case "svg":
+		c := clock.NewAfter(uint8(*renderBalls), *renderAfter)
+		err = render.SVG(file, c.State(), render.SVGOptions{Color: *renderColor, Balls: c.Balls()})
+	case "gif":
+		err = render.GIF(file, uint8(*renderBalls), render.GIFOptions{
+			Start:     *renderAfter,
+			Minutes:   *gifMinutes,
+			PerTip:    *gifPerTip,
+			FPS:       *gifFPS,
+			Color:     *renderColor,
+			Highlight: *gifHighlight,
+		})
+	default:
+		err = fmt.Errorf("Unknown render format \"%s\"", *renderFormat)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
+	return err
+}
+
 // Take a bufio Scanner and parse scanned input.
 // An error is returned if there is a problem parsing the input.
 func run(scanner *bufio.Scanner, file *os.File, validateInputOnly bool) error {
@@ -44,24 +169,23 @@ func run(scanner *bufio.Scanner, file *os.File, validateInputOnly bool) error {
 		text := scanner.Text()
 		if nBalls, err = strconv.ParseUint(text, 10, 8); err != nil {
 			msg := fmt.Sprintf("Malformed input (failed to parse \"%s\" as uint8)", text)
-			fmt.Fprintf(os.Stderr, msg)
+			fmt.Fprint(os.Stderr, msg)
 			return errors.New(msg)
 		}
 		if nBalls == END_OF_INPUT_VAL {
 			return nil
-		} else if nBalls > MAXBALLS {
-			msg := fmt.Sprintf("Malformed input (Too many balls, %d > %d)", nBalls, MAXBALLS)
-			fmt.Fprintln(os.Stderr, msg)
-			return errors.New(msg)
-		} else if nBalls < MINBALLS {
-			msg := fmt.Sprintf("Malformed input (Too few balls, %d < %d)", nBalls, MINBALLS)
+		} else if err = clock.CheckBallCount(nBalls); err != nil {
+			msg := fmt.Sprintf("Malformed input (%s)", err.Error())
 			fmt.Fprintln(os.Stderr, msg)
 			return errors.New(msg)
 		} else {
 			if !validateInputOnly {
-				fmt.Fprintf(file, "%d balls cycle after %d days.\n",
-					nBalls,
-					clock.GetDaysUntilCycle(uint8(nBalls)))
+				days, err := computeDays(uint8(nBalls))
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err.Error())
+					return err
+				}
+				fmt.Fprintf(file, "%d balls cycle after %d days.\n", nBalls, days)
 			}
 		}
 	}
@@ -84,8 +208,21 @@ func main() {
 	flag.Usage = usage
 	parseCommandLine()
 	if flag.NArg() != NARGS {
-		usage()
-		os.Exit(1)
+		mode, ok := modes[flag.Arg(0)]
+		if !ok {
+			usage()
+			os.Exit(1)
+		}
+		if err := mode(flag.Args()[1:]); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if *renderFormat != "" {
+		if err := renderClock(os.Stdout); err != nil {
+			os.Exit(1)
+		}
+		return
 	}
 
 	// The input may be of an unspecified length, so we'll use buffered IO
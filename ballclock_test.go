@@ -142,3 +142,19 @@ func TestNegativeVal(t *testing.T) {
 			expected)
 	}
 }
+
+func TestWatchSpeed(t *testing.T) {
+	for _, speed := range []string{"NaN", "+Inf", "0.1", "1e9"} {
+		if err := watch([]string{"-speed", speed}); err == nil {
+			t.Errorf("Expected an error for speed %s", speed)
+		}
+	}
+}
+
+func TestLiveSpeed(t *testing.T) {
+	for _, speed := range []string{"NaN", "+Inf", "0", "1e-10", "1e9"} {
+		if err := live([]string{"-speed", speed}); err == nil {
+			t.Errorf("Expected an error for speed %s", speed)
+		}
+	}
+}
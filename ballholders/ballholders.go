@@ -2,117 +2,365 @@
 things that hold balls
 
 For example, the clock's ball queue is a queue.  The clock's time rails
-are Rails, and both are BallHolders.
+are Rails, and both are BallHolders.  Other kinds of holder can be written by
+implementing the BallHolder interface.
+
+Like balls, the holders are generic over the type of ball ID: QueueOf[T],
+RailOf[T] and BallHolderOf[T] hold ball.Of[T], and Queue, Rail and
+BallHolder are their uint8 versions.
+
+Queues and rails marshal to text and JSON as arrays of their balls' IDs, as
+in the classic representation of a clock's state.
 
 */
 package ballholders
 
 import (
-	"container/ring"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/bgmerrell/goballclock/ball"
+	"iter"
+	"slices"
 )
 
 // A BallHolder is a thing that holds Balls
-type BallHolder struct {
+type BallHolderOf[T ball.ID] interface {
+	// Return how much the ball holder can hold
+	Capacity() int
+	// Return how much the ball holder is holding
+	Len() int
+	// Add a ball.  Any balls the holder sheds as a result are returned.
+	Add(b ball.Of[T]) []ball.Of[T]
+	// Empty the ball holder, returning its balls in the order they leave
+	Drain() []ball.Of[T]
+	// Iterate over the balls held, in order, with their positions
+	All() iter.Seq2[int, ball.Of[T]]
+	// Return the IDs of the balls held, in order
+	Snapshot() []int
+}
+
+type BallHolder = BallHolderOf[uint8]
+
+// Returned by the checked ball holder methods when there is no ball to take
+var ErrEmpty = errors.New("ballholders: no balls to take")
+
+// Returned by the checked ball holder methods when there is no room for a
+// ball
+var ErrOverflow = errors.New("ballholders: no room for ball")
+
+var _ BallHolder = (*Queue)(nil)
+var _ BallHolder = (*Rail)(nil)
+var _ encoding.TextMarshaler = Queue{}
+var _ encoding.TextMarshaler = Rail{}
+var _ encoding.TextUnmarshaler = (*Queue)(nil)
+var _ encoding.TextUnmarshaler = (*Rail)(nil)
+var _ json.Marshaler = Queue{}
+var _ json.Marshaler = Rail{}
+var _ json.Unmarshaler = (*Queue)(nil)
+var _ json.Unmarshaler = (*Rail)(nil)
+
+// The bookkeeping common to the ball holders
+type holder[T ball.ID] struct {
 	// how much the ball holder can hold
-	capacity uint8
+	capacity T
 	// how much the baller holder is holding
-	nBalls uint8
+	nBalls T
 }
 
-// Create a new BallHolder
-func NewBallHolder(capacity uint8, nBalls uint8) BallHolder {
-	return BallHolder{capacity, nBalls}
+// Create a new holder
+func newHolder[T ball.ID](capacity T, nBalls T) holder[T] {
+	return holder[T]{capacity, nBalls}
 }
 
-func (bh BallHolder) IsFull() bool {
+func (bh holder[T]) IsFull() bool {
 	return bh.capacity == bh.nBalls
 }
 
+// Return how much the ball holder can hold
+func (bh holder[T]) Capacity() int {
+	return int(bh.capacity)
+}
+
+// Return how much the ball holder is holding
+func (bh holder[T]) Len() int {
+	return int(bh.nBalls)
+}
+
+// Return an error if the ball holder holds more than it can
+func (bh holder[T]) check() error {
+	if bh.nBalls > bh.capacity {
+		return fmt.Errorf("Holding %d balls, more than capacity %d", bh.nBalls, bh.capacity)
+	}
+	return nil
+}
+
 // The clock's queue
 //
-// Queue uses a ring buffer to store the balls; instead of the balls moving
-// within the Queue, the ring buffer is updated to point to the appropriate
-// ball.
+// Queue uses a fixed-size circular buffer of ball IDs; instead of the balls
+// moving within the Queue, head is advanced to point to the first ball.
 //
 // Because balls are only ever appended, nBalls is used to determine which
 // of the balls are valid, and the rest of the queue is considered empty.
-type Queue struct {
-	BallHolder
-	ring *ring.Ring
+//
+// A ball is home when its position in the queue is its ID.  Whether the ball
+// in a slot is home depends only on where head is, so rather than check every
+// ball, Queue counts, for each slot head could be at, the balls which would
+// be home.  The count is updated as balls come and go.
+type QueueOf[T ball.ID] struct {
+	holder[T]
+	// the IDs of the balls, starting at head and wrapping around
+	ids  []T
+	head int
+	// homes[h] + homes[h+capacity] is the number of balls which are home if
+	// head is h.  Counting each ball at j-id+capacity, rather than wrapping
+	// it into range, saves a branch on every pop and append.  Balls with IDs
+	// too big to ever be home are counted in the last element.
+	homes []T
+}
+
+type Queue = QueueOf[uint8]
+
+// Create a queue of the balls with IDs ids, starting at head
+func newQueue[T ball.ID](bh holder[T], ids []T, head int) QueueOf[T] {
+	q := QueueOf[T]{bh, ids, head, make([]T, 2*len(ids)+1)}
+	for i := 0; i < int(q.nBalls); i++ {
+		q.homes[q.home(q.slot(i))]++
+	}
+	return q
 }
 
 // Create a new, full, BallHolder
 func NewQueue(capacity uint8) Queue {
-	bh := NewBallHolder(capacity, capacity)
-	r := ring.New(int(capacity))
-	for i := uint8(0); i < capacity; i++ {
-		r.Value = ball.New(i)
-		r = r.Next()
+	return NewQueueOf(capacity)
+}
+
+// Create a new, full, queue of balls with IDs of type T
+func NewQueueOf[T ball.ID](capacity T) QueueOf[T] {
+	bh := newHolder(capacity, capacity)
+	ids := make([]T, capacity)
+	for i := range ids {
+		ids[i] = T(i)
+	}
+	return newQueue(bh, ids, 0)
+}
+
+// Create a new queue holding balls, in order, with room for capacity balls
+func NewQueueFrom(capacity uint8, balls []ball.Ball) Queue {
+	return NewQueueFromOf(capacity, balls)
+}
+
+// Like NewQueueFrom, for balls with IDs of type T
+func NewQueueFromOf[T ball.ID](capacity T, balls []ball.Of[T]) QueueOf[T] {
+	bh := newHolder(capacity, T(len(balls)))
+	ids := make([]T, capacity)
+	for i, b := range balls {
+		ids[i] = b.Id
+	}
+	return newQueue(bh, ids, 0)
+}
+
+// Return an independent copy of the queue
+func (q *QueueOf[T]) Clone() QueueOf[T] {
+	return QueueOf[T]{q.holder, slices.Clone(q.ids), q.head, slices.Clone(q.homes)}
+}
+
+// Return where in homes the ball in slot j is counted
+func (q *QueueOf[T]) home(j int) int {
+	id := int(q.ids[j])
+	if id >= len(q.ids) {
+		return 2 * len(q.ids)
+	}
+	return j - id + len(q.ids)
+}
+
+// Return the number of balls which are not home, i.e., whose position in
+// the queue is not their ID
+func (q *QueueOf[T]) Displaced() int {
+	return int(q.nBalls) - int(q.homes[q.head]) - int(q.homes[q.head+len(q.ids)])
+}
+
+// Return an error if the queue's bookkeeping is inconsistent
+func (q *QueueOf[T]) Check() error {
+	if len(q.ids) != int(q.capacity) {
+		return fmt.Errorf("%d slots, expected capacity %d", len(q.ids), q.capacity)
+	}
+	if q.head < 0 || q.head >= len(q.ids) {
+		return fmt.Errorf("Head %d out of range [0, %d)", q.head, len(q.ids))
+	}
+	if err := q.check(); err != nil {
+		return err
 	}
-	return Queue{bh, r}
+	if actual := newQueue(q.holder, q.ids, q.head); !slices.Equal(actual.homes, q.homes) {
+		return fmt.Errorf("Home counts %v, expected %v", q.homes, actual.homes)
+	}
+	return nil
+}
+
+// Return the index into ids of the i-th ball from the beginning
+func (q *QueueOf[T]) slot(i int) int {
+	i += q.head
+	if i >= len(q.ids) {
+		i -= len(q.ids)
+	}
+	return i
+}
+
+// Like Pop, but ErrEmpty is returned if the queue is empty
+func (q *QueueOf[T]) PopChecked() (ball.Of[T], error) {
+	if q.nBalls == 0 {
+		return ball.Of[T]{}, ErrEmpty
+	}
+	return q.Pop(), nil
 }
 
-// Get a ball from the beginning of the queue
-func (q *Queue) Pop() ball.Ball {
+// Get a ball from the beginning of the queue.  The queue must not be empty;
+// see PopChecked.
+func (q *QueueOf[T]) Pop() ball.Of[T] {
 	q.nBalls--
-	ball := q.ring.Value.(ball.Ball)
-	q.ring = q.ring.Next()
-	return ball
+	q.homes[q.home(q.head)]--
+	id := q.ids[q.head]
+	q.head = q.slot(1)
+	return ball.NewOf(id)
 }
 
 // Return true if the balls are in their original position in the queue
-func (q *Queue) DoCycleCheck() bool {
-	if !q.IsFull() {
-		return false
-	}
-	tmp := q.ring
-	for i := uint8(0); i < q.capacity; i++ {
-		ball := q.ring.Value.(ball.Ball)
-		q.ring = q.ring.Next()
-		if ball.Id != i {
-			// restore ring
-			q.ring = tmp
-			return false
-		}
-	}
-	return true
+func (q *QueueOf[T]) DoCycleCheck() bool {
+	return q.IsFull() && q.Displaced() == 0
 }
 
 // Return a representation of the queue for testing
 //
 // -1 means empty
-func (q *Queue) GetTestRepr() []int {
+func (q *QueueOf[T]) GetTestRepr() []int {
 	repr := make([]int, q.capacity)
-	for i := uint8(0); i < q.capacity; i++ {
-		ball := q.ring.Value.(ball.Ball)
-		q.ring = q.ring.Next()
-		if i >= q.nBalls {
+	for i := range repr {
+		if i >= int(q.nBalls) {
 			repr[i] = -1 // empty
 		} else {
-			repr[i] = int(ball.Id)
+			repr[i] = int(q.ids[q.slot(i)])
 		}
 	}
 	return repr
 }
 
-// Put an array of balls back to the end of the queue
-func (q *Queue) Push(balls []ball.Ball) {
-	tmp := q.ring
-	q.ring = q.ring.Move(int(q.nBalls))
+// Like Push, but ErrOverflow is returned, and none of the balls are added, if
+// there is not room for all of them
+func (q *QueueOf[T]) PushChecked(balls []ball.Of[T]) error {
+	if len(balls) > int(q.capacity)-int(q.nBalls) {
+		return ErrOverflow
+	}
+	q.Push(balls)
+	return nil
+}
+
+// Put an array of balls back to the end of the queue.  There must be room
+// for them; see PushChecked.
+func (q *QueueOf[T]) Push(balls []ball.Of[T]) {
 	for i := range balls {
-		q.nBalls++
-		q.ring.Value = balls[i]
-		q.ring = q.ring.Next()
+		q.Append(balls[i])
+	}
+}
+
+// Add a ball to the end of the queue.  A full queue has no room for the
+// ball, so it is shed.
+func (q *QueueOf[T]) Add(b ball.Of[T]) []ball.Of[T] {
+	if q.IsFull() {
+		return []ball.Of[T]{b}
+	}
+	q.Append(b)
+	return nil
+}
+
+// Like Append, but ErrOverflow is returned if the queue is full
+func (q *QueueOf[T]) AppendChecked(b ball.Of[T]) error {
+	if q.IsFull() {
+		return ErrOverflow
+	}
+	q.Append(b)
+	return nil
+}
+
+// Put a ball at the end of the queue.  The queue must not be full; see
+// AppendChecked.
+func (q *QueueOf[T]) Append(b ball.Of[T]) {
+	j := q.slot(int(q.nBalls))
+	q.ids[j] = b.Id
+	q.homes[q.home(j)]++
+	q.nBalls++
+}
+
+// Empty the queue, returning its balls from the beginning
+func (q *QueueOf[T]) Drain() []ball.Of[T] {
+	balls := make([]ball.Of[T], 0, q.nBalls)
+	for q.nBalls > 0 {
+		balls = append(balls, q.Pop())
+	}
+	return balls
+}
+
+// Iterate over the balls in the queue from the beginning, with their
+// positions
+func (q *QueueOf[T]) All() iter.Seq2[int, ball.Of[T]] {
+	return func(yield func(int, ball.Of[T]) bool) {
+		for i := 0; i < int(q.nBalls); i++ {
+			if !yield(i, ball.NewOf(q.ids[q.slot(i)])) {
+				return
+			}
+		}
+	}
+}
+
+// Return the IDs of the balls in the queue from the beginning
+func (q *QueueOf[T]) Snapshot() []int {
+	return snapshot(q)
+}
+
+// Return a copy of the balls in the queue from the beginning
+func (q *QueueOf[T]) Balls() []ball.Of[T] {
+	return slices.Collect(q.Values())
+}
+
+// Return the i-th ball from the beginning of the queue.  It panics if i is
+// out of range [0, Len()).
+func (q *QueueOf[T]) At(i int) ball.Of[T] {
+	if i < 0 || i >= int(q.nBalls) {
+		panic(fmt.Sprintf("ballholders: index %d out of range [0, %d)", i, q.nBalls))
+	}
+	return ball.NewOf(q.ids[q.slot(i)])
+}
+
+// Iterate over the balls in the queue from the beginning
+func (q *QueueOf[T]) Values() iter.Seq[ball.Of[T]] {
+	return values(q)
+}
+
+// Iterate over the balls a holder holds, in order
+func values[T ball.ID](h BallHolderOf[T]) iter.Seq[ball.Of[T]] {
+	return func(yield func(ball.Of[T]) bool) {
+		for _, b := range h.All() {
+			if !yield(b) {
+				return
+			}
+		}
 	}
-	q.ring = tmp
+}
+
+// Collect the IDs of the balls a holder holds
+func snapshot[T ball.ID](h BallHolderOf[T]) []int {
+	ids := make([]int, 0, h.Len())
+	for _, b := range h.All() {
+		ids = append(ids, int(b.Id))
+	}
+	return ids
 }
 
 // The clock's time rails
 //
 // A Rail holds Balls, but can spill them (down to another ball holder)
 //
-// Rail uses an array to store the balls.
+// Rail uses an array to store the balls' IDs.
 //
 // Unlike a Queue, balls are never "popped" one at a time; instead, when the
 // rail is full, all balls are spilled in reverse order.
@@ -120,53 +368,260 @@ func (q *Queue) Push(balls []ball.Ball) {
 // Because balls are only ever appended, nBalls is used to determine where to
 // put the balls in the array, and to determine which of the balls are valid,
 // while the rest of the array is considered empty.
-type Rail struct {
-	BallHolder
-	Balls []ball.Ball
+type RailOf[T ball.ID] struct {
+	holder[T]
+	ids []T
 }
 
+type Rail = RailOf[uint8]
+
 // Create a new, empty, Rail
 func NewRail(capacity uint8) Rail {
-	bh := NewBallHolder(capacity, 0)
-	balls := make([]ball.Ball, capacity)
-	return Rail{bh, balls}
+	return NewRailOf(capacity)
+}
+
+// Create a new, empty, rail for balls with IDs of type T
+func NewRailOf[T ball.ID](capacity T) RailOf[T] {
+	bh := newHolder(capacity, 0)
+	return RailOf[T]{bh, make([]T, capacity)}
+}
+
+// Create a new rail holding balls, in order, with room for capacity balls
+func NewRailFrom(capacity uint8, balls []ball.Ball) Rail {
+	return NewRailFromOf(capacity, balls)
+}
+
+// Like NewRailFrom, for balls with IDs of type T
+func NewRailFromOf[T ball.ID](capacity T, balls []ball.Of[T]) RailOf[T] {
+	r := NewRailOf(capacity)
+	for i, b := range balls {
+		r.ids[i] = b.Id
+	}
+	r.nBalls = T(len(balls))
+	return r
+}
+
+// Return an independent copy of the rail
+func (r *RailOf[T]) Clone() RailOf[T] {
+	return RailOf[T]{r.holder, slices.Clone(r.ids)}
 }
 
 // Empty the ball holder and return a reversed list of the spilt Balls
-func (r *Rail) spill() []ball.Ball {
+func (r *RailOf[T]) spill() []ball.Of[T] {
 	// Seriously, golang, no reverse abstraction? :\
-	spilledBalls := make([]ball.Ball, r.capacity)
-	for i := range r.Balls {
-		spilledBalls[r.capacity-1-uint8(i)] = r.Balls[i]
+	spilledBalls := make([]ball.Of[T], r.capacity)
+	for i := range r.ids {
+		spilledBalls[r.capacity-1-T(i)] = ball.NewOf(r.ids[i])
+		r.ids[i] = 0
 	}
 	return spilledBalls
 }
 
 // Add a ball to the rail.  If the rail is full, it will spill.
 // A slice of spilled balls is returned.
-func (r *Rail) Push(b ball.Ball) []ball.Ball {
+func (r *RailOf[T]) Push(b ball.Of[T]) []ball.Of[T] {
 	if r.IsFull() {
 		// Reset state and spill
 		r.nBalls = 0
 		return r.spill()
 	}
 
-	r.Balls[r.nBalls] = b
+	r.ids[r.nBalls] = b.Id
 	r.nBalls++
-	return []ball.Ball{}
+	return []ball.Of[T]{}
+}
+
+// Like PushOrSpill, but ErrOverflow is returned, and nothing is moved, if q
+// does not have room for the spilled balls
+func (r *RailOf[T]) PushOrSpillChecked(b ball.Of[T], q *QueueOf[T]) (bool, error) {
+	if r.IsFull() && int(r.nBalls) > int(q.capacity)-int(q.nBalls) {
+		return false, ErrOverflow
+	}
+	return r.PushOrSpill(b, q), nil
+}
+
+// Like Push, but the spilled balls go straight to the end of q, without
+// allocating.  true is returned if the rail spilled.  q must have room for
+// them; see PushOrSpillChecked.
+func (r *RailOf[T]) PushOrSpill(b ball.Of[T], q *QueueOf[T]) bool {
+	if r.IsFull() {
+		for i := len(r.ids) - 1; i >= 0; i-- {
+			q.Append(ball.NewOf(r.ids[i]))
+			r.ids[i] = 0
+		}
+		r.nBalls = 0
+		return true
+	}
+
+	r.ids[r.nBalls] = b.Id
+	r.nBalls++
+	return false
+}
+
+// Add a ball to the rail.  If the rail is full, the ball tips it, so the
+// spilled balls are shed followed by the ball itself, which passes on as it
+// would to the next rail of a clock.  See Push.
+func (r *RailOf[T]) Add(b ball.Of[T]) []ball.Of[T] {
+	if r.IsFull() {
+		return append(r.Push(b), b)
+	}
+	return r.Push(b)
+}
+
+// Empty the rail, returning its balls in reverse order as a spill does
+func (r *RailOf[T]) Drain() []ball.Of[T] {
+	balls := make([]ball.Of[T], r.nBalls)
+	for i := range balls {
+		balls[len(balls)-1-i] = ball.NewOf(r.ids[i])
+		r.ids[i] = 0
+	}
+	r.nBalls = 0
+	return balls
+}
+
+// Iterate over the balls on the rail from the bottom, with their slots
+func (r *RailOf[T]) All() iter.Seq2[int, ball.Of[T]] {
+	return func(yield func(int, ball.Of[T]) bool) {
+		for i := 0; i < int(r.nBalls); i++ {
+			if !yield(i, ball.NewOf(r.ids[i])) {
+				return
+			}
+		}
+	}
+}
+
+// Return the IDs of the balls on the rail from the bottom
+func (r *RailOf[T]) Snapshot() []int {
+	return snapshot(r)
+}
+
+// Return a copy of the balls on the rail from the bottom
+func (r *RailOf[T]) Balls() []ball.Of[T] {
+	return slices.Collect(r.Values())
+}
+
+// Return the ball in slot i of the rail, counting from the bottom.  It panics
+// if i is out of range [0, Len()).
+func (r *RailOf[T]) At(i int) ball.Of[T] {
+	if i < 0 || i >= int(r.nBalls) {
+		panic(fmt.Sprintf("ballholders: index %d out of range [0, %d)", i, r.nBalls))
+	}
+	return ball.NewOf(r.ids[i])
+}
+
+// Iterate over the balls on the rail from the bottom
+func (r *RailOf[T]) Values() iter.Seq[ball.Of[T]] {
+	return values(r)
+}
+
+// Return an error if the rail's bookkeeping is inconsistent.  Unused slots
+// must hold ID 0; a stale ball 0 cannot be told apart from it.
+func (r *RailOf[T]) Check() error {
+	if len(r.ids) != int(r.capacity) {
+		return fmt.Errorf("%d slots, expected capacity %d", len(r.ids), r.capacity)
+	}
+	if err := r.check(); err != nil {
+		return err
+	}
+	for i := int(r.nBalls); i < len(r.ids); i++ {
+		if r.ids[i] != 0 {
+			return fmt.Errorf("Stale ball %d in unused slot %d", r.ids[i], i)
+		}
+	}
+	return nil
 }
 
 // Return a representation of the rail for testing
 //
 // -1 means empty
-func (r *Rail) GetTestRepr() []int {
+func (r *RailOf[T]) GetTestRepr() []int {
 	repr := make([]int, r.capacity)
-	for i := uint8(0); i < r.capacity; i++ {
+	for i := T(0); i < r.capacity; i++ {
 		if i >= r.nBalls {
 			repr[i] = -1 // empty
 		} else {
-			repr[i] = int(r.Balls[i].Id)
+			repr[i] = int(r.ids[i])
 		}
 	}
 	return repr
 }
+
+// Marshal the queue as a JSON array of its balls' IDs, from the beginning
+func (q QueueOf[T]) MarshalJSON() ([]byte, error) {
+	return marshal(&q)
+}
+
+// Replace the queue's balls with those in data, a JSON array of ball IDs.  The
+// queue keeps its capacity, unless it is the zero queue, in which case it is
+// made just big enough.
+func (q *QueueOf[T]) UnmarshalJSON(data []byte) error {
+	balls, capacity, err := unmarshal(data, q.capacity)
+	if err != nil {
+		return err
+	}
+	*q = NewQueueFromOf(capacity, balls)
+	return nil
+}
+
+// Like MarshalJSON
+func (q QueueOf[T]) MarshalText() ([]byte, error) {
+	return q.MarshalJSON()
+}
+
+// Like UnmarshalJSON
+func (q *QueueOf[T]) UnmarshalText(text []byte) error {
+	return q.UnmarshalJSON(text)
+}
+
+// Marshal the rail as a JSON array of its balls' IDs, in order
+func (r RailOf[T]) MarshalJSON() ([]byte, error) {
+	return marshal(&r)
+}
+
+// Replace the rail's balls with those in data, a JSON array of ball IDs.  The
+// rail keeps its capacity, unless it is the zero rail, in which case it is
+// made just big enough.
+func (r *RailOf[T]) UnmarshalJSON(data []byte) error {
+	balls, capacity, err := unmarshal(data, r.capacity)
+	if err != nil {
+		return err
+	}
+	*r = NewRailFromOf(capacity, balls)
+	return nil
+}
+
+// Like MarshalJSON
+func (r RailOf[T]) MarshalText() ([]byte, error) {
+	return r.MarshalJSON()
+}
+
+// Like UnmarshalJSON
+func (r *RailOf[T]) UnmarshalText(text []byte) error {
+	return r.UnmarshalJSON(text)
+}
+
+// Marshal the balls a holder holds as a JSON array
+func marshal[T ball.ID](h BallHolderOf[T]) ([]byte, error) {
+	// not nil, so that an empty holder is [] rather than null
+	balls := make([]ball.Of[T], 0, h.Len())
+	for _, b := range h.All() {
+		balls = append(balls, b)
+	}
+	return json.Marshal(balls)
+}
+
+// Unmarshal the balls for a holder with room for capacity balls.  A capacity
+// of 0 is taken to mean just enough room.
+func unmarshal[T ball.ID](data []byte, capacity T) ([]ball.Of[T], T, error) {
+	var balls []ball.Of[T]
+	if err := json.Unmarshal(data, &balls); err != nil {
+		return nil, 0, err
+	}
+	if capacity == 0 {
+		capacity = T(len(balls))
+	}
+	if len(balls) > int(capacity) {
+		return nil, 0, fmt.Errorf("%w (%d balls for %d places)", ErrOverflow, len(balls), capacity)
+	}
+	return balls, capacity, nil
+}
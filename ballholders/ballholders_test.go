@@ -1,15 +1,20 @@
 package ballholders
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/bgmerrell/goballclock/ball"
+	"iter"
+	"math/rand/v2"
+	"slices"
 	"testing"
 )
 
-func TestNewBallHolder(t *testing.T) {
+func TestNewHolder(t *testing.T) {
 	const EXPECTED_CAPACITY = 4
 	const EXPECTED_NBALLS = EXPECTED_CAPACITY
-	bh := NewBallHolder(EXPECTED_CAPACITY, EXPECTED_CAPACITY)
+	bh := newHolder[uint8](EXPECTED_CAPACITY, EXPECTED_CAPACITY)
 	if bh.capacity != EXPECTED_CAPACITY {
 		t.Errorf("Unexpected capacity (actual %d, expected %d)",
 			bh.capacity, EXPECTED_CAPACITY)
@@ -39,20 +44,19 @@ func TestNewQueue(t *testing.T) {
 		t.Errorf("Unexpected nBalls (actual %d, expected %d)",
 			q.nBalls, EXPECTED_NBALLS)
 	}
-	if q.ring.Len() != EXPECTED_CAPACITY {
-		t.Errorf("Unexpected length of ring (actual %d, expected %d)",
-			q.ring.Len(), EXPECTED_CAPACITY)
-	}
-	// Go through ring twice to test it
-	for i := 0; i < 2; i++ {
-		for i := 0; i < q.ring.Len(); i++ {
-			if q.ring.Value.(ball.Ball).Id != uint8(i) {
-				t.Errorf("Ball out of order (actual %d, expected %d)",
-					q.ring.Value.(ball.Ball).Id,
-					i)
-			}
-			q.ring = q.ring.Next()
+	if len(q.ids) != EXPECTED_CAPACITY {
+		t.Errorf("Unexpected length of buffer (actual %d, expected %d)",
+			len(q.ids), EXPECTED_CAPACITY)
+	}
+	// Go through the buffer twice, wrapping around, to test it
+	for i := 0; i < 2*len(q.ids); i++ {
+		b := q.Pop()
+		if b.Id != uint8(i%len(q.ids)) {
+			t.Errorf("Ball out of order (actual %d, expected %d)",
+				b.Id,
+				i%len(q.ids))
 		}
+		q.Push([]ball.Ball{b})
 	}
 }
 
@@ -109,9 +113,9 @@ func TestRailPushAndSpill(t *testing.T) {
 
 	// Push a ball with an ID of 1, and check the Balls slice
 	spilledBalls = r.Push(ball.New(1))
-	if r.Balls[0].Id != 1 {
+	if r.ids[0] != 1 {
 		t.Errorf("Unexpected ball ID after rail push (actual %d, expected %d)",
-			r.Balls[0].Id, 1)
+			r.ids[0], 1)
 	}
 	// Nothing should have spilled
 	if len(spilledBalls) != 0 {
@@ -131,12 +135,12 @@ func TestRailPushAndSpill(t *testing.T) {
 	if len(spilledBalls) != 0 {
 		t.Errorf("Unexpected spilled balls (%v), expected no spillage", spilledBalls)
 	}
-	for i := range r.Balls {
+	for i := range r.ids {
 		// i + 1, because we started at 1 to distinguish between test
 		// the zero-value of the array
-		if r.Balls[i].Id != uint8(i+1) {
+		if r.ids[i] != uint8(i+1) {
 			t.Errorf("Unexpected ball ID after rail push (actual %d, expected %d)",
-				r.Balls[i].Id, i+1)
+				r.ids[i], i+1)
 		}
 	}
 
@@ -158,3 +162,399 @@ func TestRailPushAndSpill(t *testing.T) {
 			expected)
 	}
 }
+
+func TestClone(t *testing.T) {
+	q := NewQueue(5)
+	q.Pop()
+	clone := q.Clone()
+	q.Pop()
+	q.Push([]ball.Ball{ball.New(0)})
+	if fmt.Sprintf("%v", clone.GetTestRepr()) != "[1 2 3 4 -1]" {
+		t.Errorf("Unexpected clone of queue: %v", clone.GetTestRepr())
+	}
+	if fmt.Sprintf("%v", q.GetTestRepr()) != "[2 3 4 0 -1]" {
+		t.Errorf("Unexpected queue: %v", q.GetTestRepr())
+	}
+
+	r := NewRail(4)
+	r.Push(ball.New(1))
+	rclone := r.Clone()
+	r.Push(ball.New(2))
+	if fmt.Sprintf("%v", rclone.GetTestRepr()) != "[1 -1 -1 -1]" {
+		t.Errorf("Unexpected clone of rail: %v", rclone.GetTestRepr())
+	}
+}
+
+func TestNewFrom(t *testing.T) {
+	q := NewQueueFrom(5, []ball.Ball{ball.New(3), ball.New(1)})
+	if fmt.Sprintf("%v", q.GetTestRepr()) != "[3 1 -1 -1 -1]" {
+		t.Errorf("Unexpected queue: %v", q.GetTestRepr())
+	}
+	q.Push([]ball.Ball{ball.New(4)})
+	if b := q.Pop(); b.Id != 3 {
+		t.Errorf("Unexpected ball ID (actual %d, expected %d)", b.Id, 3)
+	}
+
+	r := NewRailFrom(4, []ball.Ball{ball.New(2), ball.New(0)})
+	if fmt.Sprintf("%v", r.GetTestRepr()) != "[2 0 -1 -1]" {
+		t.Errorf("Unexpected rail: %v", r.GetTestRepr())
+	}
+}
+
+func TestCheck(t *testing.T) {
+	q := NewQueue(5)
+	if err := q.Check(); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+
+	r := NewRail(4)
+	for i := uint8(1); i <= 5; i++ {
+		r.Push(ball.New(i))
+		if err := r.Check(); err != nil {
+			t.Errorf("Unexpected error after %d pushes: %s", i, err.Error())
+		}
+	}
+	r.ids[3] = 2
+	if err := r.Check(); err == nil {
+		t.Errorf("Expected an error for a stale ball")
+	}
+	r.ids[3] = 0
+	r.nBalls = 5
+	if err := r.Check(); err == nil {
+		t.Errorf("Expected an error for an overfull rail")
+	}
+}
+
+// A ball holder written outside the package: balls leave in the reverse of
+// the order they arrived
+type stack struct {
+	balls []ball.Ball
+}
+
+func (s *stack) Capacity() int { return 255 }
+func (s *stack) Len() int      { return len(s.balls) }
+func (s *stack) Add(b ball.Ball) []ball.Ball {
+	s.balls = append(s.balls, b)
+	return nil
+}
+func (s *stack) Drain() []ball.Ball {
+	balls := make([]ball.Ball, len(s.balls))
+	for i, b := range s.balls {
+		balls[len(balls)-1-i] = b
+	}
+	s.balls = nil
+	return balls
+}
+func (s *stack) All() iter.Seq2[int, ball.Ball] { return slices.All(s.balls) }
+func (s *stack) Snapshot() []int                { return snapshot(s) }
+
+func TestBallHolder(t *testing.T) {
+	q := NewQueueFrom(5, []ball.Ball{ball.New(3)})
+	r := NewRail(4)
+	for _, c := range []struct {
+		holder            BallHolder
+		capacity          int
+		snapshot, drained string
+	}{
+		{&q, 5, "[3 0 1 2]", "[3 0 1 2]"},
+		{&r, 4, "[0 1 2]", "[2 1 0]"},
+		{&stack{}, 255, "[0 1 2]", "[2 1 0]"},
+	} {
+		for i := uint8(0); i < 3; i++ {
+			if spilled := c.holder.Add(ball.New(i)); len(spilled) != 0 {
+				t.Errorf("Unexpected spill from %T: %v", c.holder, spilled)
+			}
+		}
+		if c.holder.Capacity() != c.capacity {
+			t.Errorf("Unexpected capacity of %T (actual %d, expected %d)",
+				c.holder, c.holder.Capacity(), c.capacity)
+		}
+		if actual := fmt.Sprint(c.holder.Snapshot()); actual != c.snapshot {
+			t.Errorf("Unexpected snapshot of %T (actual %s, expected %s)", c.holder, actual, c.snapshot)
+		}
+		var ids []int
+		for _, b := range c.holder.Drain() {
+			ids = append(ids, int(b.Id))
+		}
+		if actual := fmt.Sprint(ids); actual != c.drained {
+			t.Errorf("Unexpected drained balls of %T (actual %s, expected %s)", c.holder, actual, c.drained)
+		}
+		if c.holder.Len() != 0 {
+			t.Errorf("Expected %T to be empty after draining", c.holder)
+		}
+
+		// fill the holder, then add one more.  No ball may be lost.
+		for i := 0; i < c.capacity && i < 10; i++ {
+			c.holder.Add(ball.New(uint8(10 + i)))
+		}
+		before := c.holder.Len()
+		shed := c.holder.Add(ball.New(99))
+		if c.holder.Len()+len(shed) != before+1 {
+			t.Errorf("%T lost a ball (held %d, shed %v, holding %v)", c.holder, before, shed, c.holder.Snapshot())
+		}
+		if len(shed) != 0 && shed[len(shed)-1].Id != 99 {
+			t.Errorf("Expected %T to shed the added ball last, got %v", c.holder, shed)
+		}
+		if c.holder.Len() > c.capacity {
+			t.Errorf("%T holding %d balls, more than its capacity", c.holder, c.holder.Len())
+		}
+	}
+	if err := q.Check(); err != nil {
+		t.Errorf("Unexpected queue error: %s", err.Error())
+	}
+	if err := r.Check(); err != nil {
+		t.Errorf("Unexpected rail error: %s", err.Error())
+	}
+	if fmt.Sprint(q.Snapshot()) != "[10 11 12 13 14]" || fmt.Sprint(r.Snapshot()) != "[]" {
+		t.Errorf("Unexpected holders after overfilling (queue %v, rail %v)", q.Snapshot(), r.Snapshot())
+	}
+}
+
+func TestPushOrSpill(t *testing.T) {
+	q := NewQueueFrom(8, []ball.Ball{ball.New(7)})
+	r := NewRail(4)
+	for i := uint8(0); i < 4; i++ {
+		if r.PushOrSpill(ball.New(i), &q) {
+			t.Errorf("Unexpected spill after %d pushes", i+1)
+		}
+	}
+	if !r.PushOrSpill(ball.New(4), &q) {
+		t.Errorf("Expected the full rail to spill")
+	}
+	if fmt.Sprint(q.GetTestRepr()) != "[7 3 2 1 0 -1 -1 -1]" {
+		t.Errorf("Unexpected queue: %v", q.GetTestRepr())
+	}
+	if fmt.Sprint(r.GetTestRepr()) != "[-1 -1 -1 -1]" {
+		t.Errorf("Unexpected rail: %v", r.GetTestRepr())
+	}
+	if err := r.Check(); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		// the ball that tips the rail goes on too, as in the clock
+		if b := q.Pop(); r.PushOrSpill(b, &q) {
+			q.Append(b)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Unexpected allocations (actual %g, expected 0)", allocs)
+	}
+}
+
+func TestDisplaced(t *testing.T) {
+	// rotate the queue by one ball at a time, and reverse runs of balls at
+	// the end of it as the rails do
+	q := NewQueue(7)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 1000; i++ {
+		n := 1 + rng.IntN(3)
+		balls := make([]ball.Ball, n)
+		for j := range balls {
+			balls[len(balls)-1-j] = q.Pop()
+		}
+		if rng.IntN(2) == 0 {
+			slices.Reverse(balls)
+		}
+		q.Push(balls)
+
+		displaced := 0
+		for pos, id := range q.GetTestRepr() {
+			if id != pos {
+				displaced++
+			}
+		}
+		if q.Displaced() != displaced {
+			t.Fatalf("Unexpected displaced balls in %v (actual %d, expected %d)",
+				q.GetTestRepr(), q.Displaced(), displaced)
+		}
+		if q.DoCycleCheck() != (displaced == 0) {
+			t.Fatalf("Unexpected cycle check of %v", q.GetTestRepr())
+		}
+		if err := q.Check(); err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+	}
+
+	// a ball whose ID is beyond the queue is never home
+	q = NewQueueFrom(3, []ball.Ball{ball.New(0), ball.New(1), ball.New(200)})
+	if q.Displaced() != 1 || q.DoCycleCheck() {
+		t.Errorf("Unexpected displaced balls (actual %d, expected %d)", q.Displaced(), 1)
+	}
+}
+
+func TestInspectionDoesNotMutate(t *testing.T) {
+	q := NewQueueFrom(5, []ball.Ball{ball.New(2), ball.New(0), ball.New(1)})
+	before := q.Clone()
+	q.GetTestRepr()
+	q.DoCycleCheck()
+	q.Snapshot()
+	q.Displaced()
+	for range q.All() {
+		break
+	}
+	if q.head != before.head || !slices.Equal(q.ids, before.ids) ||
+		!slices.Equal(q.homes, before.homes) || q.nBalls != before.nBalls {
+		t.Errorf("Queue changed by inspection")
+	}
+}
+
+func ballIds(balls []ball.Ball) []uint8 {
+	ids := make([]uint8, len(balls))
+	for i, b := range balls {
+		ids[i] = b.Id
+	}
+	return ids
+}
+
+func TestViews(t *testing.T) {
+	q := NewQueue(5)
+	q.Pop()
+	q.Push([]ball.Ball{ball.New(0)})
+	r := NewRailFrom(4, []ball.Ball{ball.New(2), ball.New(0)})
+	for _, c := range []struct {
+		holder interface {
+			BallHolder
+			Balls() []ball.Ball
+			At(i int) ball.Ball
+			Values() iter.Seq[ball.Ball]
+		}
+		expected string
+	}{
+		{&q, "[1 2 3 4 0]"},
+		{&r, "[2 0]"},
+	} {
+		balls := c.holder.Balls()
+		if fmt.Sprint(ballIds(balls)) != c.expected {
+			t.Errorf("Unexpected balls of %T (actual %v, expected %s)", c.holder, balls, c.expected)
+		}
+		// the copy is the caller's to change
+		balls[0] = ball.New(9)
+		if c.holder.At(0) == balls[0] {
+			t.Errorf("Expected Balls to return a copy")
+		}
+		if actual := fmt.Sprint(ballIds(slices.Collect(c.holder.Values()))); actual != c.expected {
+			t.Errorf("Unexpected values of %T (actual %s, expected %s)", c.holder, actual, c.expected)
+		}
+		for i := 0; i < c.holder.Len(); i++ {
+			if c.holder.At(i) != c.holder.Balls()[i] {
+				t.Errorf("Unexpected ball %d of %T: %v", i, c.holder, c.holder.At(i))
+			}
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected At to panic out of range")
+				}
+			}()
+			c.holder.At(c.holder.Len())
+		}()
+	}
+}
+
+func TestChecked(t *testing.T) {
+	q := NewQueueFrom(3, []ball.Ball{ball.New(0)})
+	if b, err := q.PopChecked(); err != nil || b.Id != 0 {
+		t.Errorf("Unexpected pop (ball %v, error %v)", b, err)
+	}
+	if _, err := q.PopChecked(); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Unexpected length after failed pop (actual %d, expected 0)", q.Len())
+	}
+	if err := q.PushChecked([]ball.Ball{ball.New(1), ball.New(2), ball.New(0), ball.New(3)}); err != ErrOverflow {
+		t.Errorf("Expected ErrOverflow, got %v", err)
+	}
+	if err := q.PushChecked([]ball.Ball{ball.New(1), ball.New(2)}); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if err := q.AppendChecked(ball.New(0)); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if err := q.AppendChecked(ball.New(3)); err != ErrOverflow {
+		t.Errorf("Expected ErrOverflow, got %v", err)
+	}
+	if fmt.Sprint(q.GetTestRepr()) != "[1 2 0]" {
+		t.Errorf("Unexpected queue: %v", q.GetTestRepr())
+	}
+
+	// a full rail cannot spill into a queue without room
+	r := NewRailFrom(4, []ball.Ball{ball.New(4), ball.New(5), ball.New(6), ball.New(7)})
+	q = NewQueueFrom(6, []ball.Ball{ball.New(0), ball.New(1), ball.New(2)})
+	if _, err := r.PushOrSpillChecked(ball.New(3), &q); err != ErrOverflow {
+		t.Errorf("Expected ErrOverflow, got %v", err)
+	}
+	if r.Len() != 4 || q.Len() != 3 {
+		t.Errorf("Expected nothing to move after overflow")
+	}
+	q.Pop()
+	if tipped, err := r.PushOrSpillChecked(ball.New(3), &q); !tipped || err != nil {
+		t.Errorf("Unexpected push (tipped %v, error %v)", tipped, err)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	// a queue which has wrapped around its buffer
+	q := NewQueue(5)
+	q.Pop()
+	q.Pop()
+	q.Append(ball.New(0))
+	r := NewRailFrom(4, []ball.Ball{ball.New(1)})
+	empty := NewRail(4)
+	for _, tc := range []struct {
+		h        any
+		expected string
+	}{
+		{&q, "[2,3,4,0]"},
+		{&r, "[1]"},
+		{&empty, "[]"},
+		// values as well as pointers
+		{q, "[2,3,4,0]"},
+		{map[string]Rail{"Min": r}, `{"Min":[1]}`},
+	} {
+		if data, err := json.Marshal(tc.h); err != nil || string(data) != tc.expected {
+			t.Errorf("Unexpected JSON %s (error %v)", data, err)
+		}
+	}
+	if text, err := q.MarshalText(); err != nil || string(text) != "[2,3,4,0]" {
+		t.Errorf("Unexpected text %s (error %v)", text, err)
+	}
+
+	// holders keep their capacity
+	if err := json.Unmarshal([]byte("[4, 3]"), &q); err != nil || q.Capacity() != 5 || fmt.Sprint(q.Snapshot()) != "[4 3]" {
+		t.Errorf("Unexpected queue %v, capacity %d (error %v)", q.Snapshot(), q.Capacity(), err)
+	}
+	if err := r.UnmarshalText([]byte("[2,0]")); err != nil || fmt.Sprint(r.GetTestRepr()) != "[2 0 -1 -1]" {
+		t.Errorf("Unexpected rail %v (error %v)", r.GetTestRepr(), err)
+	}
+	if err := r.Check(); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if err := json.Unmarshal([]byte("[0,1,2,3,4]"), &r); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Expected ErrOverflow, got %v", err)
+	}
+	if err := json.Unmarshal([]byte(`{"Main": [0]}`), &q); err == nil {
+		t.Errorf("Expected an error for an object")
+	}
+
+	// unless they are zero
+	var wide QueueOf[uint16]
+	if err := json.Unmarshal([]byte("[299, 0, 300]"), &wide); err != nil || wide.Capacity() != 3 || wide.At(2).Id != 300 {
+		t.Errorf("Unexpected queue %v (error %v)", wide.Snapshot(), err)
+	}
+	var zero Rail
+	if err := zero.UnmarshalJSON([]byte("[1,2]")); err != nil || zero.Capacity() != 2 || !zero.IsFull() {
+		t.Errorf("Unexpected rail %v (error %v)", zero.Snapshot(), err)
+	}
+}
+
+func BenchmarkQueuePopPush(b *testing.B) {
+	q := NewQueue(127)
+	balls := make([]ball.Ball, 5)
+	for i := 0; i < b.N; i++ {
+		for j := range balls {
+			balls[j] = q.Pop()
+		}
+		q.Push(balls)
+	}
+}
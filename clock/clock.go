@@ -2,9 +2,13 @@
 package clock
 
 import (
+	"context"
+	"fmt"
 	"github.com/bgmerrell/goballclock/ball"
-	"github.com/bgmerrell/goballclock/ballholders"
 	"math"
+	"runtime"
+	"sort"
+	"sync"
 )
 
 // static ballholder capacities
@@ -12,64 +16,394 @@ const HOUR_RAIL_CAP = 11
 const FIVE_MIN_RAIL_CAP = 11
 const ONE_MIN_RAIL_CAP = 4
 
-var queue ballholders.Queue
-var hourRail ballholders.Rail
-var fiveMinRail ballholders.Rail
-var oneMinRail ballholders.Rail
-var nClockRefreshes uint64
+// The range of queue capacities the clock accepts
+const MAX_BALLS = 127
+const MIN_BALLS = 27
 
-func init() {
-	hourRail = ballholders.NewRail(HOUR_RAIL_CAP)
-	fiveMinRail = ballholders.NewRail(FIVE_MIN_RAIL_CAP)
-	oneMinRail = ballholders.NewRail(ONE_MIN_RAIL_CAP)
+// A ball clock: a queue of balls feeding three time rails
+type Clock struct {
+	mech mechanism
+	// Number of minutes the clock has run
+	nMinutes uint64
+	// Number of times the clock refreshes, i.e., the number of 12-hour
+	// periods
+	nClockRefreshes uint64
+	// Number of times each rail has tipped
+	nOneMinTips  uint64
+	nFiveMinTips uint64
+	nHourTips    uint64
+	// Whether findCycle validates the clock after every minute
+	debug bool
+}
+
+// Counts of what happened while a clock ran
+type Stats struct {
+	Minutes     uint64
+	Refreshes   uint64
+	OneMinTips  uint64
+	FiveMinTips uint64
+	HourTips    uint64
+}
+
+// A snapshot of the clock's ball holders, listing the IDs of the balls in
+// each, in order.
+type State struct {
+	Min     []int
+	FiveMin []int
+	Hour    []int
+	Main    []int
 }
 
-// Update the clock state by adding ball
-func updateClockState(b ball.Ball) {
-	var spilledBalls []ball.Ball
+// Return an error if nBalls is outside of the range the clock accepts
+func CheckBallCount(nBalls uint64) error {
+	if nBalls > MAX_BALLS {
+		return fmt.Errorf("Too many balls, %d > %d", nBalls, MAX_BALLS)
+	} else if nBalls < MIN_BALLS {
+		return fmt.Errorf("Too few balls, %d < %d", nBalls, MIN_BALLS)
+	}
+	return nil
+}
+
+// Create a new clock with a full queue of nBalls balls and empty rails
+func New(nBalls uint8) *Clock {
+	return &Clock{mech: newHolders(nBalls)}
+}
 
-	spilledBalls = oneMinRail.Push(b)
-	if len(spilledBalls) == 0 {
-		return
+// Like New, but for any number of balls from MIN_BALLS to MAX_WIDE_BALLS.
+// The clock's ball IDs are as narrow as the number of balls allows, so small
+// clocks run as fast as those from New.
+func NewN(nBalls int) (*Clock, error) {
+	if err := checkWideBallCount(nBalls); err != nil {
+		return nil, err
 	}
-	queue.Push(spilledBalls)
+	return &Clock{mech: newMechanism(nBalls)}, nil
+}
+
+// Create a new clock with a full queue of balls and empty rails.  The balls
+// keep their attributes and lift counts, but must be in ID order, i.e.,
+// balls[i].Id == i.  Only up to MAX_BALLS balls can be given this way; the
+// balls of clocks from NewN have no attributes.
+func NewFromBalls(balls []ball.Tracked[uint8]) (*Clock, error) {
+	if err := CheckBallCount(uint64(len(balls))); err != nil {
+		return nil, err
+	}
+	for i, b := range balls {
+		if int(b.Id) != i {
+			return nil, fmt.Errorf("Ball %d has ID %d", i, b.Id)
+		}
+	}
+	h := newHolders(uint8(len(balls)))
+	h.attrs = make([]*ball.Attributes, len(balls))
+	for i, b := range balls {
+		h.lifts[i] = b.Lifts
+		h.attrs[i] = b.Attrs
+	}
+	return &Clock{mech: h}, nil
+}
+
+// Create a clock in the given state, with its counts of what has happened so
+// far set from stats.  An error is returned if the state is not one a clock
+// could be in.  The balls have no attributes and have not been lifted.
+func FromState(s State, stats Stats) (*Clock, error) {
+	if err := Validate(s); err != nil {
+		return nil, err
+	}
+	return &Clock{
+		mech:            holdersFromState[uint8](s),
+		nMinutes:        stats.Minutes,
+		nClockRefreshes: stats.Refreshes,
+		nOneMinTips:     stats.OneMinTips,
+		nFiveMinTips:    stats.FiveMinTips,
+		nHourTips:       stats.HourTips,
+	}, nil
+}
+
+// Return the number of minutes a fresh clock must run to display hour:minute.
+// hour may be given on a 12- or 24-hour dial; 0, 12 and 24 all mean 12, but 24
+// only as 24:00.
+func MinutesForTime(hour int, minute int) (uint64, error) {
+	if hour < 0 || hour > 24 || minute < 0 || minute > 59 || hour == 24 && minute > 0 {
+		return 0, fmt.Errorf("Invalid time %d:%02d", hour, minute)
+	}
+	// the clock starts at 1:00
+	return uint64(((hour%12)+11)%12*60 + minute), nil
+}
 
-	spilledBalls = fiveMinRail.Push(b)
-	if len(spilledBalls) == 0 {
-		return
+// Return an independent copy of the clock
+func (c *Clock) Clone() *Clock {
+	clone := *c
+	clone.mech = c.mech.clone()
+	return &clone
+}
+
+// Turn on or off validating the clock after every minute while looking for a
+// cycle.  An invariant breaking stops the search with an error describing
+// the minute that broke it.
+func (c *Clock) SetDebug(debug bool) {
+	c.debug = debug
+}
+
+// What happened during one minute of the clock
+type Move struct {
+	// ID of the ball taken from the queue
+	Ball int
+	// Number of rails the ball tipped: 0 if it stayed on the one minute
+	// rail, up to 3 if it tipped every rail and returned to the queue
+	Tips int
+}
+
+// Advance the clock by one minute.  It panics if the clock's ball holders
+// are inconsistent; see StepChecked.
+func (c *Clock) Step() Move {
+	move, err := c.StepChecked()
+	if err != nil {
+		panic(err)
 	}
-	queue.Push(spilledBalls)
+	return move
+}
 
-	spilledBalls = hourRail.Push(b)
-	if len(spilledBalls) == 0 {
-		return
+// Like Step, but an error is returned if a ball holder runs out of balls or
+// overflows, which cannot happen unless the clock was put together wrongly.
+// The error wraps ballholders.ErrEmpty or ballholders.ErrOverflow.
+func (c *Clock) StepChecked() (Move, error) {
+	id, tips, err := c.mech.step()
+	if err != nil {
+		return Move{}, fmt.Errorf("Minute %d: %w", c.nMinutes+1, err)
+	}
+	c.nMinutes++
+	if tips > 0 {
+		c.nOneMinTips++
+	}
+	if tips > 1 {
+		c.nFiveMinTips++
 	}
-	queue.Push(append(spilledBalls, b))
+	if tips > 2 {
+		c.nHourTips++
+	}
+	// the queue can only fill up when the hour rail tips
+	if tips == 3 && c.mech.refreshed() {
+		c.nClockRefreshes++
+	}
+	return Move{id, tips}, nil
 }
 
 // Detect a cycle occurrence in a ball clock and track time for that cycle to
 // occur
-func findCycle(queueCapacity uint8) {
+//
+// ctx is checked, and progress (if not nil) is called, on every clock
+// refresh.  If ctx is done before the cycle is found, its error is returned.
+func (c *Clock) findCycle(ctx context.Context, progress func(minutes uint64, refreshes uint64)) error {
 	// break when the balls are all back in their original positions in the
 	// queue
 	for {
-		ball := queue.Pop()
-		updateClockState(ball)
-		if queue.IsFull() {
-			nClockRefreshes++
-			if queue.DoCycleCheck() {
-				break
+		if c.debug {
+			if err := c.debugStep(); err != nil {
+				return err
+			}
+			if !c.mech.refreshed() {
+				continue
 			}
+		} else if err := c.runUntilRefresh(); err != nil {
+			return err
 		}
+		if c.mech.cycled() {
+			return nil
+		}
+		if progress != nil {
+			progress(c.nMinutes, c.nClockRefreshes)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// Run the clock until its queue next fills up
+func (c *Clock) runUntilRefresh() error {
+	minutes, tips, err := c.mech.run()
+	c.nMinutes += minutes
+	c.nOneMinTips += tips[1] + tips[2] + tips[3]
+	c.nFiveMinTips += tips[2] + tips[3]
+	c.nHourTips += tips[3]
+	if err != nil {
+		return fmt.Errorf("Minute %d: %w", c.nMinutes+1, err)
 	}
+	c.nClockRefreshes++
+	return nil
+}
+
+// Step the clock, checking its invariants still hold afterwards
+func (c *Clock) debugStep() error {
+	before := c.State()
+	if _, err := c.StepChecked(); err != nil {
+		return err
+	}
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("Invariant broken at minute %d: %s\n%s",
+			c.nMinutes, err.Error(), diffStates(before, c.State()))
+	}
+	return nil
+}
+
+// Return the number of minutes the clock has run
+func (c *Clock) Minutes() uint64 {
+	return c.nMinutes
+}
+
+// Return the number of times the clock has refreshed
+func (c *Clock) Refreshes() uint64 {
+	return c.nClockRefreshes
+}
+
+// Return counts of what has happened since the clock was created
+func (c *Clock) Stats() Stats {
+	return Stats{c.nMinutes, c.nClockRefreshes, c.nOneMinTips, c.nFiveMinTips, c.nHourTips}
+}
+
+// Return the time displayed by the rails, on a 12-hour dial starting at 1:00
+func (c *Clock) Time() (hour int, minute int) {
+	return c.State().Time()
+}
+
+// Return the time displayed by the rails formatted as H:MM
+func (c *Clock) TimeString() string {
+	return c.State().TimeString()
 }
 
+// Return the time displayed by the rails, on a 12-hour dial starting at 1:00
+func (s State) Time() (hour int, minute int) {
+	return len(s.Hour) + 1, len(s.FiveMin)*5 + len(s.Min)
+}
+
+// Return the time displayed by the rails formatted as H:MM
+func (s State) TimeString() string {
+	hour, minute := s.Time()
+	return fmt.Sprintf("%d:%02d", hour, minute)
+}
+
+// Return the number of balls in the clock
+func (s State) NBalls() int {
+	return len(s.Min) + len(s.FiveMin) + len(s.Hour) + len(s.Main)
+}
+
+// Return copies of the clock's balls, in ID order.  Their IDs are widened to
+// uint32 whatever the width the clock uses.
+func (c *Clock) Balls() []ball.Tracked[uint32] {
+	return c.mech.balls()
+}
+
+// Return a snapshot of the clock's ball holders
+func (c *Clock) State() State {
+	return c.mech.state()
+}
+
+// Return the number of days a clock of queueCapacity balls takes to cycle.
+// Like Step, it panics if the clock cannot run, e.g., with too few balls.
 func GetDaysUntilCycle(queueCapacity uint8) uint64 {
-	// Number of times the clock refreshes, i.e., the number of 12-hour
-	// periods
-	nClockRefreshes = 0
-	queue = ballholders.NewQueue(queueCapacity)
-	findCycle(queueCapacity)
+	days, err := GetDaysUntilCycleContext(context.Background(), queueCapacity, nil)
+	if err != nil {
+		panic(err)
+	}
+	return days
+}
+
+// Like GetDaysUntilCycle, but the computation can be cancelled through ctx
+// and reports its progress to progress (if not nil) on every clock refresh
+func GetDaysUntilCycleContext(ctx context.Context, queueCapacity uint8,
+	progress func(minutes uint64, refreshes uint64)) (uint64, error) {
+	return New(queueCapacity).DaysUntilCycle(ctx, progress)
+}
+
+// Run the clock until its balls are back in their original order and return
+// the number of days that took.  See GetDaysUntilCycleContext.
+func (c *Clock) DaysUntilCycle(ctx context.Context,
+	progress func(minutes uint64, refreshes uint64)) (uint64, error) {
+	if err := c.findCycle(ctx, progress); err != nil {
+		return 0, err
+	}
 	// There 2 clock refreshes in a day
-	return uint64(math.Ceil(float64(nClockRefreshes) / 2.0))
+	return uint64(math.Ceil(float64(c.nClockRefreshes) / 2.0)), nil
+}
+
+// Days until cycle for one ball count
+type Cycle struct {
+	Balls uint8  `json:"balls"`
+	Days  uint64 `json:"days"`
+	// What happened while the clock ran until it cycled
+	Stats Stats `json:"stats"`
+}
+
+// Compute the days until cycle for every ball count from from to to
+// (inclusive), spread over as many goroutines as there are CPUs.  The results
+// are in ball count order.  If ctx is done first, its error is returned.
+func CycleTable(ctx context.Context, from uint8, to uint8) ([]Cycle, error) {
+	if from > to {
+		return nil, nil
+	}
+	table := make([]Cycle, int(to)-int(from)+1)
+	counts := make(chan int)
+	errs := make(chan error, len(table))
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range counts {
+				nBalls := from + uint8(i)
+				c := New(nBalls)
+				days, err := c.DaysUntilCycle(ctx, nil)
+				if err != nil {
+					errs <- err
+					continue
+				}
+				table[i] = Cycle{nBalls, days, c.Stats()}
+			}
+		}()
+	}
+	for i := range table {
+		counts <- i
+	}
+	close(counts)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// Return the permutation the queue undergoes every 12 hours: after a
+// refresh, the ball at position i of the queue is the one that was at
+// position p[i] before it.
+func HalfDayPermutation(nBalls uint8) []int {
+	return halfDayPermutation(int(nBalls))
+}
+
+// Like HalfDayPermutation, for any number of balls NewN accepts
+func halfDayPermutation(nBalls int) []int {
+	c := &Clock{mech: newMechanism(nBalls)}
+	for i := 0; i < 720; i++ {
+		c.Step()
+	}
+	return c.State().Main
+}
+
+// Return the lengths of the cycles of a permutation, longest first.  The
+// least common multiple of the lengths is the number of times the
+// permutation must be applied to restore the original order.
+func CycleLengths(p []int) []int {
+	var lengths []int
+	seen := make([]bool, len(p))
+	for i := range p {
+		n := 0
+		for j := i; !seen[j]; j = p[j] {
+			seen[j] = true
+			n++
+		}
+		if n > 0 {
+			lengths = append(lengths, n)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(lengths)))
+	return lengths
 }
@@ -1,21 +1,29 @@
 package clock
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/bgmerrell/goballclock/ball"
 	"github.com/bgmerrell/goballclock/ballholders"
 	"testing"
 )
 
+// The ball holders of a clock made by New
+func narrow(c *Clock) *holders[uint8] {
+	return c.mech.(*holders[uint8])
+}
+
 func TestUpdateClockState(t *testing.T) {
 	const QUEUE_CAP = 27
-	queue = ballholders.NewQueue(QUEUE_CAP)
+	c := newHolders[uint8](QUEUE_CAP)
 
 	// Run ball 0 through the clock
-	b := queue.Pop()
-	updateClockState(b)
+	b := c.queue.Pop()
+	c.updateClockState(b)
 
 	// Check queue state
-	actual := queue.GetTestRepr()
+	actual := c.queue.GetTestRepr()
 	expected := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
 		16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, -1}
 
@@ -28,7 +36,7 @@ func TestUpdateClockState(t *testing.T) {
 	}
 
 	// Check rail states
-	actual = oneMinRail.GetTestRepr()
+	actual = c.oneMinRail.GetTestRepr()
 	expected = []int{0, -1, -1, -1}
 	if fmt.Sprintf("%v", actual) != fmt.Sprintf("%v", expected) {
 		t.Fatalf("Unexpected queue state\n"+
@@ -38,7 +46,7 @@ func TestUpdateClockState(t *testing.T) {
 			expected)
 	}
 	// And the other rails should be empty
-	actual = fiveMinRail.GetTestRepr()
+	actual = c.fiveMinRail.GetTestRepr()
 	expected = []int{-1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1}
 	if fmt.Sprintf("%v", actual) != fmt.Sprintf("%v", expected) {
 		t.Fatalf("Unexpected queue state\n"+
@@ -48,7 +56,7 @@ func TestUpdateClockState(t *testing.T) {
 			expected)
 	}
 	// And the other rails should be empty
-	actual = hourRail.GetTestRepr()
+	actual = c.hourRail.GetTestRepr()
 	expected = []int{-1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1}
 	if fmt.Sprintf("%v", actual) != fmt.Sprintf("%v", expected) {
 		t.Fatalf("Unexpected queue state\n"+
@@ -61,11 +69,11 @@ func TestUpdateClockState(t *testing.T) {
 	// Running 4 more balls through the clock shoul should result in the
 	// first four balls going back on the queue in reverse order...
 	for i := 0; i < 4; i++ {
-		b = queue.Pop()
-		updateClockState(b)
+		b = c.queue.Pop()
+		c.updateClockState(b)
 	}
 
-	actual = queue.GetTestRepr()
+	actual = c.queue.GetTestRepr()
 	expected = []int{5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
 		16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 3, 2, 1, 0, -1}
 
@@ -77,7 +85,7 @@ func TestUpdateClockState(t *testing.T) {
 			expected)
 	}
 	// ...And we should see the 4 ball show up on the next rail down
-	actual = fiveMinRail.GetTestRepr()
+	actual = c.fiveMinRail.GetTestRepr()
 	expected = []int{4, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1}
 	if fmt.Sprintf("%v", actual) != fmt.Sprintf("%v", expected) {
 		t.Fatalf("Unexpected queue state\n"+
@@ -90,11 +98,11 @@ func TestUpdateClockState(t *testing.T) {
 	// The clock capacity is 11 hours, 59 minutes (719 minutes).  We've
 	// already run 5.
 	for i := 0; i < (719 - 5); i++ {
-		b = queue.Pop()
-		updateClockState(b)
+		b = c.queue.Pop()
+		c.updateClockState(b)
 	}
 
-	actual = queue.GetTestRepr()
+	actual = c.queue.GetTestRepr()
 	for i := 0; i < QUEUE_CAP; i++ {
 		// The clock should be full and there should only be one ball
 		// in the queue
@@ -109,13 +117,13 @@ func TestUpdateClockState(t *testing.T) {
 
 	// After one more ball run the queue should be full and the rails
 	// should be empty
-	b = queue.Pop()
-	updateClockState(b)
-	if !queue.IsFull() {
+	b = c.queue.Pop()
+	c.updateClockState(b)
+	if !c.queue.IsFull() {
 		t.Fatalf("Expected queue to be full")
 	}
 	// Check rail states
-	for n, rail := range []ballholders.Rail{oneMinRail, fiveMinRail, hourRail} {
+	for n, rail := range []ballholders.Rail{c.oneMinRail, c.fiveMinRail, c.hourRail} {
 		actual = rail.GetTestRepr()
 		for i := 0; i < len(actual); i++ {
 			if actual[i] != -1 {
@@ -128,3 +136,410 @@ func TestUpdateClockState(t *testing.T) {
 		}
 	}
 }
+
+func TestGetDaysUntilCycle(t *testing.T) {
+	for nBalls, expected := range map[uint8]uint64{30: 15, 45: 378} {
+		actual := GetDaysUntilCycle(nBalls)
+		if actual != expected {
+			t.Errorf("Unexpected days until cycle for %d balls (actual %d, expected %d)",
+				nBalls, actual, expected)
+		}
+	}
+
+	// an undersized clock has no answer
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected GetDaysUntilCycle to panic for 3 balls")
+			}
+		}()
+		GetDaysUntilCycle(3)
+	}()
+	if days, err := GetDaysUntilCycleContext(context.Background(), 3, nil); !errors.Is(err, ballholders.ErrEmpty) {
+		t.Errorf("Expected ErrEmpty for 3 balls, got %d days (error %v)", days, err)
+	}
+	// clocks too big for the classic limit still run
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GetDaysUntilCycleContext(ctx, 200, nil); err != context.Canceled {
+		t.Errorf("Unexpected error for 200 balls (actual %v, expected %v)", err, context.Canceled)
+	}
+	if days, err := New(3).DaysUntilCycle(context.Background(), nil); !errors.Is(err, ballholders.ErrEmpty) {
+		t.Errorf("Expected ErrEmpty for 3 balls, got %d days (error %v)", days, err)
+	}
+}
+
+func TestStepAndTime(t *testing.T) {
+	c := New(30)
+	if c.TimeString() != "1:00" {
+		t.Errorf("Unexpected initial time (actual %s, expected %s)", c.TimeString(), "1:00")
+	}
+	// 1 hour, 2 five minute balls, 3 minute balls
+	for i := 0; i < 73; i++ {
+		c.Step()
+	}
+	if c.TimeString() != "2:13" {
+		t.Errorf("Unexpected time (actual %s, expected %s)", c.TimeString(), "2:13")
+	}
+	if c.Minutes() != 73 {
+		t.Errorf("Unexpected minutes (actual %d, expected %d)", c.Minutes(), 73)
+	}
+	s := c.State()
+	if len(s.Min) != 3 || len(s.FiveMin) != 2 || len(s.Hour) != 1 || len(s.Main) != 24 {
+		t.Errorf("Unexpected state: %v", s)
+	}
+}
+
+func TestCheckBallCount(t *testing.T) {
+	if err := CheckBallCount(MIN_BALLS); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	err := CheckBallCount(MAX_BALLS + 1)
+	expected := "Too many balls, 128 > 127"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error (actual %v, expected %s)", err, expected)
+	}
+	err = CheckBallCount(MIN_BALLS - 1)
+	expected = "Too few balls, 26 < 27"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error (actual %v, expected %s)", err, expected)
+	}
+}
+
+func TestGetDaysUntilCycleContext(t *testing.T) {
+	var nProgress uint64
+	days, err := GetDaysUntilCycleContext(context.Background(), 30,
+		func(minutes uint64, refreshes uint64) {
+			nProgress++
+			if refreshes != nProgress || minutes != refreshes*720 {
+				t.Errorf("Unexpected progress (minutes %d, refreshes %d)", minutes, refreshes)
+			}
+		})
+	if err != nil || days != 15 {
+		t.Errorf("Unexpected result (days %d, error %v)", days, err)
+	}
+	// The final refresh completes the cycle and is not reported
+	if nProgress != 29 {
+		t.Errorf("Unexpected number of progress reports (actual %d, expected %d)", nProgress, 29)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = GetDaysUntilCycleContext(ctx, 30, nil); err != context.Canceled {
+		t.Errorf("Unexpected error (actual %v, expected %v)", err, context.Canceled)
+	}
+}
+
+func TestStats(t *testing.T) {
+	c := New(30)
+	for i := 0; i < 720; i++ {
+		c.Step()
+	}
+	expected := Stats{Minutes: 720, Refreshes: 1, OneMinTips: 144, FiveMinTips: 12, HourTips: 1}
+	if c.Stats() != expected {
+		t.Errorf("Unexpected stats (actual %+v, expected %+v)", c.Stats(), expected)
+	}
+}
+
+func TestStepMoves(t *testing.T) {
+	c := New(30)
+	for i := 0; i < 720; i++ {
+		move := c.Step()
+		expected := 0
+		switch {
+		case i == 719:
+			expected = 3
+		case i%60 == 59:
+			expected = 2
+		case i%5 == 4:
+			expected = 1
+		}
+		if move.Tips != expected {
+			t.Fatalf("Unexpected tips at minute %d (actual %d, expected %d)",
+				i+1, move.Tips, expected)
+		}
+	}
+	// The ball that tips the hour rail returns to the queue last
+	c = New(30)
+	var move Move
+	for i := 0; i < 720; i++ {
+		move = c.Step()
+	}
+	s := c.State()
+	if s.Main[len(s.Main)-1] != move.Ball {
+		t.Errorf("Unexpected last ball in queue (actual %d, expected %d)",
+			s.Main[len(s.Main)-1], move.Ball)
+	}
+}
+
+func TestCycleTable(t *testing.T) {
+	table, err := CycleTable(context.Background(), 30, 33)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	var days []string
+	for _, c := range table {
+		days = append(days, fmt.Sprintf("%d:%d", c.Balls, c.Days))
+	}
+	expected := "[30:15 31:85 32:65 33:138]"
+	if fmt.Sprintf("%v", days) != expected {
+		t.Errorf("Unexpected table (actual %v, expected %s)", days, expected)
+	}
+	if table[0].Stats.Refreshes != 30 || table[0].Stats.Minutes != 30*720 {
+		t.Errorf("Unexpected stats for 30 balls: %+v", table[0].Stats)
+	}
+}
+
+func TestCycleLengths(t *testing.T) {
+	actual := CycleLengths([]int{1, 2, 0, 3, 5, 4})
+	expected := "[3 2 1]"
+	if fmt.Sprintf("%v", actual) != expected {
+		t.Errorf("Unexpected cycle lengths (actual %v, expected %s)", actual, expected)
+	}
+
+	// The order of the 12-hour permutation is the number of refreshes
+	// until the clock cycles
+	for nBalls, expected := range map[uint8]uint64{30: 30, 45: 756} {
+		order := uint64(1)
+		for _, n := range CycleLengths(HalfDayPermutation(nBalls)) {
+			order = lcm(order, uint64(n))
+		}
+		if order != expected {
+			t.Errorf("Unexpected order for %d balls (actual %d, expected %d)", nBalls, order, expected)
+		}
+	}
+}
+
+func gcd(a uint64, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func lcm(a uint64, b uint64) uint64 {
+	return a / gcd(a, b) * b
+}
+
+func TestClone(t *testing.T) {
+	c := New(30)
+	for i := 0; i < 100; i++ {
+		c.Step()
+	}
+	clone := c.Clone()
+	before := fmt.Sprintf("%v", clone.State())
+	for i := 0; i < 100; i++ {
+		c.Step()
+	}
+	if fmt.Sprintf("%v", clone.State()) != before || clone.Minutes() != 100 {
+		t.Errorf("Clone changed along with the original clock")
+	}
+	for i := 0; i < 100; i++ {
+		clone.Step()
+	}
+	if fmt.Sprintf("%v", clone.State()) != fmt.Sprintf("%v", c.State()) {
+		t.Errorf("Clone diverged from the original clock")
+	}
+}
+
+func TestFromState(t *testing.T) {
+	c := New(30)
+	for i := 0; i < 1000; i++ {
+		c.Step()
+	}
+	restored, err := FromState(c.State(), c.Stats())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	for i := 0; i < 1000; i++ {
+		c.Step()
+		restored.Step()
+	}
+	if fmt.Sprintf("%v", restored.State()) != fmt.Sprintf("%v", c.State()) ||
+		restored.Stats() != c.Stats() {
+		t.Errorf("Restored clock diverged from the original")
+	}
+
+	for _, tc := range []struct {
+		s        State
+		expected string
+	}{
+		{State{Main: []int{0, 1}}, "Too few balls, 2 < 27"},
+		{State{Min: []int{0, 1, 2, 3, 4}, Main: []int{5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17,
+			18, 19, 20, 21, 22, 23, 24, 25, 26}}, "Too many balls in Min, 5 > 4"},
+		{State{Main: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20,
+			21, 22, 23, 24, 25, 25}}, "Ball 25 appears more than once"},
+		{State{Main: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20,
+			21, 22, 23, 24, 25, 27}}, "Ball ID 27 in Main out of range [0, 27)"},
+	} {
+		_, err := FromState(tc.s, Stats{})
+		if err == nil || err.Error() != tc.expected {
+			t.Errorf("Unexpected error (actual %v, expected %s)", err, tc.expected)
+		}
+	}
+}
+
+func TestMinutesForTime(t *testing.T) {
+	for _, tc := range []struct {
+		hour     int
+		minute   int
+		expected uint64
+	}{{1, 0, 0}, {12, 59, 719}, {0, 30, 690}, {13, 5, 5}, {23, 59, 659}, {24, 0, 660}} {
+		actual, err := MinutesForTime(tc.hour, tc.minute)
+		if err != nil || actual != tc.expected {
+			t.Errorf("Unexpected minutes for %d:%02d (actual %d, expected %d, error %v)",
+				tc.hour, tc.minute, actual, tc.expected, err)
+		}
+	}
+	for _, hour := range [][2]int{{25, 0}, {24, 1}, {24, 59}} {
+		if _, err := MinutesForTime(hour[0], hour[1]); err == nil {
+			t.Errorf("Expected an error for %d:%02d", hour[0], hour[1])
+		}
+	}
+}
+
+func TestStepChecked(t *testing.T) {
+	// a queue with no balls
+	c := New(30)
+	narrow(c).queue = ballholders.NewQueueFrom(30, nil)
+	if _, err := c.StepChecked(); !errors.Is(err, ballholders.ErrEmpty) {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected Step to panic")
+			}
+		}()
+		c.Step()
+	}()
+
+	// balls on the one minute rail which are also in the full queue
+	c = New(30)
+	narrow(c).oneMinRail = ballholders.NewRailFrom(ONE_MIN_RAIL_CAP,
+		[]ball.Ball{ball.New(0), ball.New(1), ball.New(2), ball.New(3)})
+	_, err := c.StepChecked()
+	if !errors.Is(err, ballholders.ErrOverflow) || err.Error() != "Minute 1: Min: ballholders: no room for ball" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err = c.DaysUntilCycle(context.Background(), nil); !errors.Is(err, ballholders.ErrOverflow) {
+		t.Errorf("Expected ErrOverflow, got %v", err)
+	}
+}
+
+func TestNewFromBalls(t *testing.T) {
+	balls := make([]ball.Tracked[uint8], 30)
+	for i := range balls {
+		balls[i].Id = uint8(i)
+	}
+	balls[7] = ball.NewWithAttributes(7, ball.Attributes{Label: "worn", Material: "brass"})
+	c, err := NewFromBalls(balls)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	for i := 0; i < 1440; i++ {
+		c.Step()
+	}
+	var lifts uint64
+	for i, b := range c.Balls() {
+		if int(b.Id) != i {
+			t.Errorf("Unexpected ball %d at %d", b.Id, i)
+		}
+		lifts += b.Lifts
+	}
+	if lifts != 1440 {
+		t.Errorf("Unexpected total lifts (actual %d, expected %d)", lifts, 1440)
+	}
+	if worn := c.Balls()[7]; worn.Label() != "worn" || worn.Attrs.Material != "brass" || worn.Lifts == 0 {
+		t.Errorf("Unexpected ball 7 after a day: %+v %+v", worn, worn.Attrs)
+	}
+	if s := fmt.Sprint(c.State()); s != fmt.Sprint(NewAfter(30, 1440).State()) {
+		t.Errorf("Unexpected state: %s", s)
+	}
+
+	balls[3], balls[4] = balls[4], balls[3]
+	if _, err = NewFromBalls(balls); err == nil {
+		t.Errorf("Expected an error for balls out of order")
+	}
+	if _, err = NewFromBalls(balls[:20]); err == nil {
+		t.Errorf("Expected an error for too few balls")
+	}
+}
+
+func TestStepAllocs(t *testing.T) {
+	c := New(45)
+	// a day covers every kind of tip
+	if allocs := testing.AllocsPerRun(1440, func() { c.Step() }); allocs != 0 {
+		t.Errorf("Unexpected allocations per minute (actual %g, expected 0)", allocs)
+	}
+}
+
+// Full runs until the balls cycle, from a small and a large clock
+func BenchmarkDaysUntilCycle(b *testing.B) {
+	for _, nBalls := range []uint8{45, 90} {
+		b.Run(fmt.Sprint(nBalls), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				GetDaysUntilCycle(nBalls)
+			}
+		})
+	}
+}
+
+func TestNewN(t *testing.T) {
+	for _, tc := range []struct {
+		nBalls int
+		days   uint64
+	}{
+		{30, 15},
+		{45, 378},
+		{300, 0},
+		{70000, 0},
+	} {
+		c, err := NewN(tc.nBalls)
+		if err != nil {
+			t.Fatalf("Unexpected error for %d balls: %s", tc.nBalls, err.Error())
+		}
+		if tc.days != 0 {
+			if days, err := c.DaysUntilCycle(context.Background(), nil); err != nil || days != tc.days {
+				t.Errorf("%d balls: unexpected result (days %d, error %v)", tc.nBalls, days, err)
+			}
+			continue
+		}
+		for i := 0; i < 1440; i++ {
+			if _, err := c.StepChecked(); err != nil {
+				t.Fatalf("%d balls: %s", tc.nBalls, err.Error())
+			}
+		}
+		if err := c.Validate(); err != nil {
+			t.Errorf("%d balls: %s", tc.nBalls, err.Error())
+		}
+		var lifts uint64
+		for _, b := range c.Balls() {
+			lifts += b.Lifts
+		}
+		if lifts != 1440 {
+			t.Errorf("%d balls: %d lifts in a day", tc.nBalls, lifts)
+		}
+	}
+	// wider IDs give the same answers
+	for _, c := range []*Clock{{mech: newHolders[uint16](45)}, {mech: newHolders[uint32](45)}} {
+		if days, err := c.DaysUntilCycle(context.Background(), nil); err != nil || days != 378 {
+			t.Errorf("%T: unexpected result (days %d, error %v)", c.mech, days, err)
+		}
+		if s := fmt.Sprint(c.State()); s != fmt.Sprint(New(45).State()) {
+			t.Errorf("%T: unexpected state after cycling: %s", c.mech, s)
+		}
+	}
+	if _, ok := newMechanism(300).(*holders[uint16]); !ok {
+		t.Errorf("Expected 300 balls to have uint16 IDs")
+	}
+	if _, ok := newMechanism(70000).(*holders[uint32]); !ok {
+		t.Errorf("Expected 70000 balls to have uint32 IDs")
+	}
+	if _, err := NewN(MIN_BALLS - 1); err == nil {
+		t.Errorf("Expected an error for too few balls")
+	}
+	if _, err := NewN(MAX_WIDE_BALLS + 1); err == nil {
+		t.Errorf("Expected an error for too many balls")
+	}
+}
@@ -0,0 +1,108 @@
+package clock
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"github.com/bgmerrell/goballclock/ball"
+	"github.com/bgmerrell/goballclock/ballholders"
+)
+
+var _ encoding.TextMarshaler = Clock{}
+var _ encoding.TextUnmarshaler = (*Clock)(nil)
+var _ json.Marshaler = Clock{}
+var _ json.Unmarshaler = (*Clock)(nil)
+
+// The classic representation of a clock's ball holders, as exchanged by ball
+// clock implementations, e.g.,
+//
+//	{"Min":[],"FiveMin":[],"Hour":[],"Main":[0,1,2,...]}
+//
+// It is how a State marshals to JSON, too.
+type classic[T ball.ID] struct {
+	Min     *ballholders.RailOf[T]
+	FiveMin *ballholders.RailOf[T]
+	Hour    *ballholders.RailOf[T]
+	Main    *ballholders.QueueOf[T]
+}
+
+func (h *holders[T]) classic() classic[T] {
+	return classic[T]{&h.oneMinRail, &h.fiveMinRail, &h.hourRail, &h.queue}
+}
+
+func (h *holders[T]) marshal() ([]byte, error) {
+	return json.Marshal(h.classic())
+}
+
+func (h *holders[T]) unmarshal(data []byte) error {
+	// Only the holders are replaced: the balls' lifts and attributes are
+	// kept by ID, so they stay with the balls wherever they end up.  Holders
+	// missing from data are empty.
+	h.queue = ballholders.NewQueueFromOf(T(h.queue.Capacity()), nil)
+	h.oneMinRail = ballholders.NewRailOf(T(h.oneMinRail.Capacity()))
+	h.fiveMinRail = ballholders.NewRailOf(T(h.fiveMinRail.Capacity()))
+	h.hourRail = ballholders.NewRailOf(T(h.hourRail.Capacity()))
+	c := h.classic()
+	return json.Unmarshal(data, &c)
+}
+
+// Marshal the clock's ball holders in the classic representation, which has
+// only the balls' IDs, not their lift counts or attributes.  The zero Clock
+// has no balls.
+func (c Clock) MarshalJSON() ([]byte, error) {
+	if c.mech == nil {
+		return json.Marshal(State{[]int{}, []int{}, []int{}, []int{}})
+	}
+	return c.mech.marshal()
+}
+
+// Load the ball holders from data, in the classic representation, so the
+// clock carries on from there.  The clock must be given all of its balls
+// back, and they keep their lift counts and attributes.  Its counts of what
+// it has done are those of a fresh clock reaching the state, as given by
+// ElapsedMinutes (for any number of balls), or zero if no fresh clock reaches
+// it or the minutes are too many to count.  The zero Clock takes any number
+// of balls NewN would.  The clock is left unchanged on error.
+func (c *Clock) UnmarshalJSON(data []byte) error {
+	var mech mechanism
+	if c.mech != nil {
+		mech = c.mech.clone()
+	} else {
+		var s State
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if err := checkWideBallCount(s.NBalls()); err != nil {
+			return err
+		}
+		mech = newMechanism(s.NBalls())
+	}
+	if err := mech.unmarshal(data); err != nil {
+		return err
+	}
+	loaded := Clock{mech: mech}
+	if err := loaded.Validate(); err != nil {
+		return fmt.Errorf("Impossible state (%s)", err.Error())
+	}
+	var stats Stats
+	if minutes, err := elapsedMinutes(loaded.State()); err == nil {
+		stats = statsAfter(minutes)
+	}
+	c.mech = mech
+	c.nMinutes = stats.Minutes
+	c.nClockRefreshes = stats.Refreshes
+	c.nOneMinTips = stats.OneMinTips
+	c.nFiveMinTips = stats.FiveMinTips
+	c.nHourTips = stats.HourTips
+	return nil
+}
+
+// Like MarshalJSON
+func (c Clock) MarshalText() ([]byte, error) {
+	return c.MarshalJSON()
+}
+
+// Like UnmarshalJSON
+func (c *Clock) UnmarshalText(text []byte) error {
+	return c.UnmarshalJSON(text)
+}
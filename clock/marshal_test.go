@@ -0,0 +1,179 @@
+package clock
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bgmerrell/goballclock/ball"
+	"strings"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	data, err := json.Marshal(New(5))
+	if expected := `{"Min":[],"FiveMin":[],"Hour":[],"Main":[0,1,2,3,4]}`; err != nil || string(data) != expected {
+		t.Errorf("Unexpected JSON %s (error %v)", data, err)
+	}
+
+	c := NewAfter(30, 1000)
+	data, err = json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	// the same as the state's JSON
+	if state, _ := json.Marshal(c.State()); string(data) != string(state) {
+		t.Errorf("Unexpected JSON\nActual: %s\nExpected: %s", data, state)
+	}
+	if text, err := c.MarshalText(); err != nil || string(text) != string(data) {
+		t.Errorf("Unexpected text %s (error %v)", text, err)
+	}
+
+	// load the state into a running clock, which carries on from there with
+	// counts to match
+	loaded := New(30)
+	loaded.Step()
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if loaded.Stats() != c.Stats() {
+		t.Errorf("Unexpected stats\nActual: %+v\nExpected: %+v", loaded.Stats(), c.Stats())
+	}
+	for i := 0; i < 1440; i++ {
+		c.Step()
+		loaded.Step()
+	}
+	if fmt.Sprint(loaded.State()) != fmt.Sprint(c.State()) || loaded.Stats() != c.Stats() {
+		t.Errorf("Unexpected state\nActual: %v\nExpected: %v", loaded.State(), c.State())
+	}
+
+	// another implementation's formatting, and a zero clock sized from it
+	main := "2, 0, 1"
+	for id := 3; id < MIN_BALLS; id++ {
+		main += fmt.Sprintf(", %d", id)
+	}
+	var zero Clock
+	if err := zero.UnmarshalText([]byte(`{ "Main": [` + main + `], "Hour": [],
+		"FiveMin": [], "Min": [] }`)); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if s := zero.State(); s.NBalls() != MIN_BALLS || s.Main[0] != 2 || s.Main[3] != 3 {
+		t.Errorf("Unexpected state %v", s)
+	}
+}
+
+func TestMarshalValue(t *testing.T) {
+	// a clock held by value marshals the same as a pointer to it
+	c := NewAfter(30, 1000)
+	expected, _ := json.Marshal(c)
+	data, err := json.Marshal(struct{ C Clock }{*c})
+	if err != nil || string(data) != `{"C":`+string(expected)+`}` {
+		t.Errorf("Unexpected JSON %s (error %v)", data, err)
+	}
+
+	// the zero Clock has no balls, and takes the ones it is given back
+	var zero Clock
+	data, err = json.Marshal(zero)
+	if expected := `{"Min":[],"FiveMin":[],"Hour":[],"Main":[]}`; err != nil || string(data) != expected {
+		t.Errorf("Unexpected JSON %s (error %v)", data, err)
+	}
+	if err := json.Unmarshal(expected, &zero); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if fmt.Sprint(zero.State()) != fmt.Sprint(c.State()) {
+		t.Errorf("Unexpected state\nActual: %v\nExpected: %v", zero.State(), c.State())
+	}
+}
+
+func TestUnmarshalKeepsBalls(t *testing.T) {
+	balls := make([]ball.Tracked[uint8], 30)
+	for i := range balls {
+		balls[i].Id = uint8(i)
+	}
+	balls[5] = ball.NewWithAttributes(5, ball.Attributes{Label: "chipped"})
+	c, err := NewFromBalls(balls)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	for i := 0; i < 6; i++ {
+		c.Step()
+	}
+	data, _ := json.Marshal(c)
+	// a state no fresh clock reaches: balls 4 and 6 swapped
+	var s State
+	json.Unmarshal(data, &s)
+	s.FiveMin[0], s.Main[0] = s.Main[0], s.FiveMin[0]
+	swapped, _ := json.Marshal(s)
+	if err := json.Unmarshal(swapped, c); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if c.Stats() != (Stats{}) {
+		t.Errorf("Expected counts to be reset, got %+v", c.Stats())
+	}
+	if chipped := c.Balls()[5]; chipped.Label() != "chipped" || chipped.Lifts != 1 {
+		t.Errorf("Unexpected ball 5 after loading: %+v", chipped)
+	}
+	if err := json.Unmarshal(data, c); err != nil || c.Minutes() != 6 {
+		t.Errorf("Unexpected minutes %d (error %v)", c.Minutes(), err)
+	}
+	if chipped := c.Balls()[5]; chipped.Label() != "chipped" || chipped.Lifts != 1 {
+		t.Errorf("Unexpected ball 5 after loading: %+v", chipped)
+	}
+}
+
+func TestMarshalWide(t *testing.T) {
+	// 5000 balls have cycles whose lcm is too big for an int64
+	for _, nBalls := range []int{300, 5000} {
+		c, err := NewN(nBalls)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		for i := 0; i < 1000; i++ {
+			c.Step()
+		}
+		data, err := json.Marshal(c)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		var loaded Clock
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		if fmt.Sprint(loaded.State()) != fmt.Sprint(c.State()) {
+			t.Errorf("Unexpected state for %d balls\nActual: %v\nExpected: %v", nBalls, loaded.State(), c.State())
+		}
+		// counted like a classic clock
+		if loaded.Stats() != c.Stats() {
+			t.Errorf("Unexpected stats for %d balls\nActual: %+v\nExpected: %+v", nBalls, loaded.Stats(), c.Stats())
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, tc := range []struct {
+		data     string
+		expected string
+	}{
+		{`{"Min":[],"FiveMin":[],"Hour":[],"Main":[0,1,2,3]}`, "missing [4]"},
+		{`{"Min":[0],"FiveMin":[],"Hour":[],"Main":[0,1,2,3]}`, "more than once"},
+		{`{"Min":[5],"FiveMin":[],"Hour":[],"Main":[0,1,2,3]}`, "out of range"},
+		{`{"Min":[0,1,2,3,4],"FiveMin":[],"Hour":[],"Main":[]}`, "no room for ball"},
+		{`{"Min":[],"FiveMin":[],"Hour":[],"Main":[0,1,2,3,4,5]}`, "no room for ball"},
+		{`{"Main":[0,1,2,3,"4"]}`, "Malformed ball ID"},
+		{`[0,1,2,3,4]`, "cannot unmarshal array"},
+	} {
+		c := New(5)
+		c.Step()
+		before := fmt.Sprint(c.State())
+		err := json.Unmarshal([]byte(tc.data), c)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", tc.data, tc.expected, err)
+		}
+		if fmt.Sprint(c.State()) != before {
+			t.Errorf("%s: clock changed by failed unmarshal", tc.data)
+		}
+	}
+
+	var zero Clock
+	if err := json.Unmarshal([]byte(`{"Main":[0,1]}`), &zero); err == nil || !strings.Contains(err.Error(), "Too few balls") {
+		t.Errorf("Expected an error for too few balls, got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package clock
+
+import (
+	"fmt"
+	"github.com/bgmerrell/goballclock/ball"
+	"github.com/bgmerrell/goballclock/ballholders"
+	"math"
+	"slices"
+)
+
+// The largest number of balls NewN accepts.  Clocks this big take a long time
+// to cycle and a lot of memory to run.
+const MAX_WIDE_BALLS = 1 << 24
+
+// Return an error if nBalls is outside of the range NewN accepts
+func checkWideBallCount(nBalls int) error {
+	if nBalls > MAX_WIDE_BALLS {
+		return fmt.Errorf("Too many balls, %d > %d", nBalls, MAX_WIDE_BALLS)
+	} else if nBalls < MIN_BALLS {
+		return fmt.Errorf("Too few balls, %d < %d", nBalls, MIN_BALLS)
+	}
+	return nil
+}
+
+// The ball holders of a clock, whatever the width of its ball IDs
+type mechanism interface {
+	// Lift a ball from the queue and run it through the rails, returning its
+	// ID and the number of rails it tipped
+	step() (id int, tips int, err error)
+	// Step until the queue next fills up, returning the number of minutes
+	// run and how many balls tipped each number of rails
+	run() (minutes uint64, tips [4]uint64, err error)
+	// Whether every ball is in the queue
+	refreshed() bool
+	// Whether every ball is back in its original position in the queue
+	cycled() bool
+	// The number of balls the clock was built with
+	capacity() int
+	state() State
+	// The balls in ID order
+	balls() []ball.Tracked[uint32]
+	clone() mechanism
+	// Check the ball holders' bookkeeping
+	check() error
+	// Marshal the ball holders in the classic representation
+	marshal() ([]byte, error)
+	// Replace the balls in the ball holders with those in data, in the
+	// classic representation
+	unmarshal(data []byte) error
+}
+
+// The ball holders of a clock whose ball IDs are of type T
+type holders[T ball.ID] struct {
+	queue       ballholders.QueueOf[T]
+	hourRail    ballholders.RailOf[T]
+	fiveMinRail ballholders.RailOf[T]
+	oneMinRail  ballholders.RailOf[T]
+	// The ball holders keep only IDs, so what else is known about the balls
+	// is kept here, by ID.  attrs is nil if no ball has attributes.
+	lifts []uint64
+	attrs []*ball.Attributes
+}
+
+// Return ball holders for nBalls balls with IDs as narrow as will do
+func newMechanism(nBalls int) mechanism {
+	switch {
+	case nBalls <= math.MaxUint8:
+		return newHolders(uint8(nBalls))
+	case nBalls <= math.MaxUint16:
+		return newHolders(uint16(nBalls))
+	default:
+		return newHolders(uint32(nBalls))
+	}
+}
+
+// Return ball holders with a full queue of nBalls balls and empty rails
+func newHolders[T ball.ID](nBalls T) *holders[T] {
+	return &holders[T]{
+		queue:       ballholders.NewQueueOf(nBalls),
+		hourRail:    ballholders.NewRailOf(T(HOUR_RAIL_CAP)),
+		fiveMinRail: ballholders.NewRailOf(T(FIVE_MIN_RAIL_CAP)),
+		oneMinRail:  ballholders.NewRailOf(T(ONE_MIN_RAIL_CAP)),
+		lifts:       make([]uint64, nBalls),
+	}
+}
+
+// Return ball holders in state s, which must be valid
+func holdersFromState[T ball.ID](s State) *holders[T] {
+	balls := make([][]ball.Of[T], 4)
+	for i, ids := range [][]int{s.Min, s.FiveMin, s.Hour, s.Main} {
+		for _, id := range ids {
+			balls[i] = append(balls[i], ball.NewOf(T(id)))
+		}
+	}
+	return &holders[T]{
+		queue:       ballholders.NewQueueFromOf(T(s.NBalls()), balls[3]),
+		oneMinRail:  ballholders.NewRailFromOf(T(ONE_MIN_RAIL_CAP), balls[0]),
+		fiveMinRail: ballholders.NewRailFromOf(T(FIVE_MIN_RAIL_CAP), balls[1]),
+		hourRail:    ballholders.NewRailFromOf(T(HOUR_RAIL_CAP), balls[2]),
+		lifts:       make([]uint64, s.NBalls()),
+	}
+}
+
+// Update the clock state by adding ball.  The number of rails that tipped is
+// returned, or an error if a ball holder overflows.
+func (h *holders[T]) updateClockState(b ball.Of[T]) (int, error) {
+	// a rail that tips spills straight into the queue
+	if tipped, err := h.oneMinRail.PushOrSpillChecked(b, &h.queue); !tipped || err != nil {
+		return 0, err
+	}
+	if tipped, err := h.fiveMinRail.PushOrSpillChecked(b, &h.queue); !tipped || err != nil {
+		return 1, err
+	}
+	if tipped, err := h.hourRail.PushOrSpillChecked(b, &h.queue); !tipped || err != nil {
+		return 2, err
+	}
+	return 3, h.queue.AppendChecked(b)
+}
+
+func (h *holders[T]) step() (int, int, error) {
+	b, err := h.queue.PopChecked()
+	if err != nil {
+		return 0, 0, fmt.Errorf("queue: %w", err)
+	}
+	h.lifts[b.Id]++
+	tips, err := h.updateClockState(b)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", holderNames[tips], err)
+	}
+	return int(b.Id), tips, nil
+}
+
+func (h *holders[T]) run() (minutes uint64, tips [4]uint64, err error) {
+	for {
+		_, n, err := h.step()
+		if err != nil {
+			return minutes, tips, err
+		}
+		minutes++
+		tips[n]++
+		// the queue can only fill up when the hour rail tips
+		if n == 3 && h.queue.IsFull() {
+			return minutes, tips, nil
+		}
+	}
+}
+
+// The ball holder a ball moving on from the queue goes to, by the number of
+// rails it has tipped
+var holderNames = []string{"Min", "FiveMin", "Hour", "Main"}
+
+func (h *holders[T]) refreshed() bool {
+	return h.queue.IsFull()
+}
+
+func (h *holders[T]) cycled() bool {
+	return h.queue.DoCycleCheck()
+}
+
+func (h *holders[T]) capacity() int {
+	return h.queue.Capacity()
+}
+
+func (h *holders[T]) state() State {
+	return State{
+		Min:     h.oneMinRail.Snapshot(),
+		FiveMin: h.fiveMinRail.Snapshot(),
+		Hour:    h.hourRail.Snapshot(),
+		Main:    h.queue.Snapshot(),
+	}
+}
+
+func (h *holders[T]) balls() []ball.Tracked[uint32] {
+	balls := make([]ball.Tracked[uint32], len(h.lifts))
+	for id := range balls {
+		balls[id] = ball.Tracked[uint32]{Id: uint32(id), Lifts: h.lifts[id]}
+		if h.attrs != nil {
+			balls[id].Attrs = h.attrs[id]
+		}
+	}
+	return balls
+}
+
+func (h *holders[T]) clone() mechanism {
+	return &holders[T]{
+		queue:       h.queue.Clone(),
+		hourRail:    h.hourRail.Clone(),
+		fiveMinRail: h.fiveMinRail.Clone(),
+		oneMinRail:  h.oneMinRail.Clone(),
+		lifts:       slices.Clone(h.lifts),
+		// attributes are not changed once the balls are in a clock
+		attrs: h.attrs,
+	}
+}
+
+func (h *holders[T]) check() error {
+	for _, holder := range []struct {
+		name  string
+		check func() error
+	}{
+		{"Main", h.queue.Check},
+		{"Min", h.oneMinRail.Check},
+		{"FiveMin", h.fiveMinRail.Check},
+		{"Hour", h.hourRail.Check},
+	} {
+		if err := holder.check(); err != nil {
+			return fmt.Errorf("%s: %s", holder.name, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package clock
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Setting a clock to a point in time without running it minute by minute
+//
+// The clock's mechanics never depend on which ball is which, only on where
+// balls are.  So the state after some minutes can be worked out once for
+// the positions of a fresh queue and then applied to any queue order.  Every
+// 12 hours the rails are empty and the queue has undergone the same
+// permutation, so reaching any point in time takes one application of the
+// 12-hour permutation per refresh plus one application of the positions of
+// the time of day.
+
+// The most days SetTime accepts: any more and the minutes overflow
+const MAX_DAYS = (math.MaxUint64 - 719) / 1440
+
+// Apply a permutation to a queue order: the ball at position i of the
+// result is the one at position p[i] of queue
+func permute(queue []int, p []int) []int {
+	result := make([]int, len(queue))
+	for i, j := range p {
+		result[i] = queue[j]
+	}
+	return result
+}
+
+// Replace each position of a fresh queue in s with the ball at that position
+// of queue
+func relabel(s State, queue []int) State {
+	ids := func(positions []int) []int {
+		result := make([]int, len(positions))
+		for i, pos := range positions {
+			result[i] = queue[pos]
+		}
+		return result
+	}
+	return State{ids(s.Min), ids(s.FiveMin), ids(s.Hour), ids(s.Main)}
+}
+
+// Return the permutation p applied k times, i.e., p^k, where applying p
+// then q to a queue is the same as applying r[i] = p[q[i]]
+func PermutationPower(p []int, k uint64) []int {
+	result := make([]int, len(p))
+	for i := range result {
+		result[i] = i
+	}
+	square := p
+	for ; k > 0; k >>= 1 {
+		if k&1 == 1 {
+			result = permute(result, square)
+		}
+		if k > 1 {
+			square = permute(square, square)
+		}
+	}
+	return result
+}
+
+// Return the statistics of a clock which has run for minutes minutes
+func statsAfter(minutes uint64) Stats {
+	return Stats{
+		Minutes:     minutes,
+		Refreshes:   minutes / 720,
+		OneMinTips:  minutes / 5,
+		FiveMinTips: minutes / 60,
+		HourTips:    minutes / 720,
+	}
+}
+
+// Return the queue order of a fresh clock of nBalls balls after refreshes
+// refreshes
+func queueAfterRefreshes(nBalls uint8, refreshes uint64) []int {
+	// a fresh queue is in ID order, so it ends up as the permutation itself
+	return PermutationPower(HalfDayPermutation(nBalls), refreshes)
+}
+
+// Return the state a fresh clock of nBalls balls would be in after days whole
+// days.  The rails are always empty at the end of a day, so only the queue
+// order needs working out.
+func StateAfterDays(nBalls uint8, days uint64) State {
+	halfDay := HalfDayPermutation(nBalls)
+	// a day is two refreshes, and 2*days may overflow
+	return State{
+		Min:     []int{},
+		FiveMin: []int{},
+		Hour:    []int{},
+		Main:    PermutationPower(permute(halfDay, halfDay), days),
+	}
+}
+
+// Return a clock of nBalls balls in the state a fresh one would be in after
+// running for minutes minutes.  As with FromState, the balls' lift counts
+// start from zero and they have no attributes.
+func NewAfter(nBalls uint8, minutes uint64) *Clock {
+	queue := queueAfterRefreshes(nBalls, minutes/720)
+	// positions of the time of day, from a fresh queue
+	timeOfDay := New(nBalls)
+	for i := uint64(0); i < minutes%720; i++ {
+		timeOfDay.Step()
+	}
+	c, err := FromState(relabel(timeOfDay.State(), queue), statsAfter(minutes))
+	if err != nil {
+		// relabelling a valid state by a permutation is always valid
+		panic(err)
+	}
+	return c
+}
+
+// Return a clock of nBalls balls in the state a fresh one would be in after
+// days whole days and then running until it displays hour:minute.  hour may
+// be given on a 12- or 24-hour dial.
+func SetTime(nBalls uint8, days uint64, hour int, minute int) (*Clock, error) {
+	if err := CheckBallCount(uint64(nBalls)); err != nil {
+		return nil, err
+	}
+	if days > MAX_DAYS {
+		return nil, fmt.Errorf("Too many days, %d > %d", days, MAX_DAYS)
+	}
+	offset, err := MinutesForTime(hour, minute)
+	if err != nil {
+		return nil, err
+	}
+	return NewAfter(nBalls, days*1440+offset), nil
+}
+
+// Return the fewest minutes a fresh clock must run to reach state s, or an
+// error saying why no run reaches it.
+//
+// The rail counts give the time of day, and with it the positions of a fresh
+// queue that each holder slot is filled from.  Undoing that gives the queue
+// order at the last refresh, which must be a power k of the 12-hour
+// permutation: on each of the permutation's cycles it must be a rotation,
+// and the rotations (k modulo each cycle's length) are combined by the
+// Chinese remainder theorem.
+func ElapsedMinutes(s State) (uint64, error) {
+	if err := Validate(s); err != nil {
+		return 0, err
+	}
+	return elapsedMinutes(s)
+}
+
+// Like ElapsedMinutes, for any number of balls NewN accepts.  The IDs in s
+// must already be valid; see validateIds.
+func elapsedMinutes(s State) (uint64, error) {
+	nBalls := s.NBalls()
+	offset := uint64(len(s.Hour)*60 + len(s.FiveMin)*5 + len(s.Min))
+	timeOfDay := &Clock{mech: newMechanism(nBalls)}
+	for i := uint64(0); i < offset; i++ {
+		timeOfDay.Step()
+	}
+	positions := timeOfDay.State()
+	queue := make([]int, nBalls)
+	for _, holder := range [][2][]int{
+		{positions.Min, s.Min},
+		{positions.FiveMin, s.FiveMin},
+		{positions.Hour, s.Hour},
+		{positions.Main, s.Main},
+	} {
+		for i, pos := range holder[0] {
+			queue[pos] = holder[1][i]
+		}
+	}
+
+	p := halfDayPermutation(nBalls)
+	// k = remainder (mod modulus) satisfies every cycle seen so far.  The
+	// modulus of a big clock can be too big for an int64 well before the
+	// answer is.
+	remainder, modulus := big.NewInt(0), big.NewInt(1)
+	seen := make([]bool, nBalls)
+	for i := range p {
+		if seen[i] {
+			continue
+		}
+		var cycle []int
+		for j := i; !seen[j]; j = p[j] {
+			seen[j] = true
+			cycle = append(cycle, j)
+		}
+		// p^k maps the first position of the cycle k steps along it
+		rotation := -1
+		for r, j := range cycle {
+			if queue[cycle[0]] == j {
+				rotation = r
+			}
+		}
+		if rotation == -1 {
+			return 0, fmt.Errorf("Ball %d cannot reach position %d of the queue", queue[cycle[0]], cycle[0])
+		}
+		for r, j := range cycle {
+			if queue[j] != cycle[(r+rotation)%len(cycle)] {
+				return 0, fmt.Errorf("Ball %d at position %d of the queue is out of order", queue[j], j)
+			}
+		}
+		var ok bool
+		if remainder, modulus, ok = combineCongruences(remainder, modulus,
+			big.NewInt(int64(rotation)), big.NewInt(int64(len(cycle)))); !ok {
+			return 0, fmt.Errorf("Queue order cannot be reached: balls rotate inconsistently")
+		}
+	}
+	if !remainder.IsUint64() || remainder.Uint64() > (math.MaxUint64-offset)/720 {
+		return 0, fmt.Errorf("Too many minutes to count")
+	}
+	return remainder.Uint64()*720 + offset, nil
+}
+
+// Combine x = a1 (mod m1) and x = a2 (mod m2) into x = a (mod lcm(m1, m2)).
+// ok is false if the two have no solution in common.
+func combineCongruences(a1, m1, a2, m2 *big.Int) (a *big.Int, m *big.Int, ok bool) {
+	// m1*inverse = g (mod m2)
+	g, inverse := new(big.Int), new(big.Int)
+	g.GCD(inverse, nil, m1, m2)
+	diff := new(big.Int).Sub(a2, a1)
+	if new(big.Int).Rem(diff, g).Sign() != 0 {
+		return nil, nil, false
+	}
+	m = new(big.Int).Div(m1, g)
+	m.Mul(m, m2)
+	// x = a1 + m1*t where m1*t = a2 - a1 (mod m2)
+	t := diff.Div(diff, g)
+	t.Mul(t, inverse)
+	t.Mod(t, new(big.Int).Div(m2, g))
+	a = t.Mul(t, m1)
+	a.Add(a, a1)
+	a.Mod(a, m)
+	return a, m, true
+}
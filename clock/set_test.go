@@ -0,0 +1,156 @@
+package clock
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestNewAfter(t *testing.T) {
+	c := New(31)
+	for _, minutes := range []uint64{0, 1, 719, 720, 721, 3 * 1440, 5000} {
+		for c.Minutes() < minutes {
+			c.Step()
+		}
+		jumped := NewAfter(31, minutes)
+		if fmt.Sprintf("%v", jumped.State()) != fmt.Sprintf("%v", c.State()) {
+			t.Errorf("Unexpected state after %d minutes:\n"+
+				"Actual: %v\n"+
+				"Expected: %v",
+				minutes,
+				jumped.State(),
+				c.State())
+		}
+		if jumped.Stats() != c.Stats() {
+			t.Errorf("Unexpected stats after %d minutes (actual %+v, expected %+v)",
+				minutes, jumped.Stats(), c.Stats())
+		}
+	}
+}
+
+func TestSetTime(t *testing.T) {
+	c, err := SetTime(30, 2, 15, 45)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if c.TimeString() != "3:45" {
+		t.Errorf("Unexpected time (actual %s, expected %s)", c.TimeString(), "3:45")
+	}
+	// 2 days, then from 1:00 to 3:45
+	if c.Minutes() != 2*1440+165 {
+		t.Errorf("Unexpected minutes (actual %d, expected %d)", c.Minutes(), 2*1440+165)
+	}
+
+	// After as many days as it takes to cycle, the clock is as good as new
+	c, _ = SetTime(45, 378, 1, 0)
+	if fmt.Sprintf("%v", c.State()) != fmt.Sprintf("%v", New(45).State()) {
+		t.Errorf("Expected 45 balls to be back in order after 378 days: %v", c.State())
+	}
+
+	if _, err = SetTime(30, 0, 12, 60); err == nil {
+		t.Errorf("Expected an error for 12:60")
+	}
+	if _, err = SetTime(20, 0, 12, 0); err == nil {
+		t.Errorf("Expected an error for 20 balls")
+	}
+
+	// the minutes must not overflow
+	if c, err = SetTime(30, MAX_DAYS, 12, 59); err != nil || c.Minutes() != MAX_DAYS*1440+719 {
+		t.Errorf("Unexpected result for the most days (error %v)", err)
+	}
+	if _, err = SetTime(30, MAX_DAYS+1, 1, 0); err == nil {
+		t.Errorf("Expected an error for too many days")
+	}
+	if _, err = SetTime(30, 1<<60, 1, 0); err == nil {
+		t.Errorf("Expected an error for 2^60 days")
+	}
+}
+
+func TestPermutationPower(t *testing.T) {
+	p := HalfDayPermutation(30)
+	q := make([]int, len(p))
+	for i := range q {
+		q[i] = i
+	}
+	for k := uint64(0); k < 20; k++ {
+		if actual := PermutationPower(p, k); fmt.Sprint(actual) != fmt.Sprint(q) {
+			t.Errorf("Unexpected p^%d:\nActual: %v\nExpected: %v", k, actual, q)
+		}
+		q = permute(q, p)
+	}
+}
+
+func TestStateAfterDays(t *testing.T) {
+	c := New(33)
+	for days := uint64(0); days < 5; days++ {
+		for c.Minutes() < days*1440 {
+			c.Step()
+		}
+		if actual := StateAfterDays(33, days); fmt.Sprint(actual) != fmt.Sprint(c.State()) {
+			t.Errorf("Unexpected state after %d days:\nActual: %v\nExpected: %v",
+				days, actual, c.State())
+		}
+	}
+
+	// 33 balls cycle after 138 days
+	fresh := New(33).State()
+	if actual := StateAfterDays(33, 138*10000000); fmt.Sprint(actual) != fmt.Sprint(fresh) {
+		t.Errorf("Expected 33 balls to be back in order after a multiple of 138 days: %v", actual)
+	}
+	if actual := StateAfterDays(33, 137*10000000); fmt.Sprint(actual) == fmt.Sprint(fresh) {
+		t.Errorf("Expected 33 balls out of order after 1370000000 days")
+	}
+	// twice this many days overflows
+	if actual := StateAfterDays(33, 138<<56); fmt.Sprint(actual) != fmt.Sprint(fresh) {
+		t.Errorf("Expected 33 balls to be back in order after 138 * 2^56 days: %v", actual)
+	}
+	if actual := StateAfterDays(33, 138<<56+1); fmt.Sprint(actual) != fmt.Sprint(StateAfterDays(33, 1)) {
+		t.Errorf("Unexpected state after 138 * 2^56 + 1 days: %v", actual)
+	}
+}
+
+func TestElapsedMinutes(t *testing.T) {
+	for _, minutes := range []uint64{0, 1, 59, 719, 720, 5000, 44 * 1440, 137*1440 + 611} {
+		s := NewAfter(33, minutes).State()
+		actual, err := ElapsedMinutes(s)
+		if err != nil {
+			t.Errorf("Unexpected error after %d minutes: %s", minutes, err.Error())
+		} else if actual != minutes {
+			t.Errorf("Unexpected elapsed minutes (actual %d, expected %d)", actual, minutes)
+		}
+	}
+
+	// 30 balls cycle after 15 days, so later states are reached sooner
+	actual, err := ElapsedMinutes(NewAfter(30, 15*1440+61).State())
+	if err != nil || actual != 61 {
+		t.Errorf("Unexpected elapsed minutes (actual %d, expected %d, error %v)", actual, 61, err)
+	}
+
+	s := New(30).State()
+	s.Main[0], s.Main[1] = s.Main[1], s.Main[0]
+	if _, err = ElapsedMinutes(s); err == nil {
+		t.Errorf("Expected an error for swapped balls")
+	}
+	s.Main[0] = s.Main[1]
+	if _, err = ElapsedMinutes(s); err == nil {
+		t.Errorf("Expected an error for a repeated ball")
+	}
+}
+
+func TestCombineCongruences(t *testing.T) {
+	for _, c := range []struct {
+		a1, m1, a2, m2, a, m int64
+		ok                   bool
+	}{
+		{2, 3, 3, 5, 8, 15, true},
+		{1, 4, 3, 6, 9, 12, true},
+		{1, 4, 2, 6, 0, 0, false},
+		{0, 1, 5, 7, 5, 7, true},
+	} {
+		a, m, ok := combineCongruences(big.NewInt(c.a1), big.NewInt(c.m1), big.NewInt(c.a2), big.NewInt(c.m2))
+		if ok != c.ok || ok && (a.Int64() != c.a || m.Int64() != c.m) {
+			t.Errorf("Unexpected combination of %d mod %d and %d mod %d (actual %d mod %d %v)",
+				c.a1, c.m1, c.a2, c.m2, a, m, ok)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package clock
+
+import (
+	"context"
+	"fmt"
+)
+
+// Where a ball is in the clock
+type Position struct {
+	// "Main", "Min", "FiveMin" or "Hour"
+	Holder string `json:"holder"`
+	// Position in the queue (0 drops next) or slot on the rail (0 is the
+	// bottom)
+	Index int `json:"index"`
+}
+
+// Find ball id.  false is returned if there is no such ball.
+func (s State) Find(id int) (Position, bool) {
+	for _, holder := range []struct {
+		name string
+		ids  []int
+	}{{"Main", s.Main}, {"Min", s.Min}, {"FiveMin", s.FiveMin}, {"Hour", s.Hour}} {
+		for i, other := range holder.ids {
+			if other == id {
+				return Position{holder.name, i}, true
+			}
+		}
+	}
+	return Position{}, false
+}
+
+// Where a ball was at one minute of a clock run
+type TrajectoryPoint struct {
+	// Minutes the clock had run
+	Minute uint64 `json:"minute"`
+	// Time displayed by the rails
+	Time string `json:"time"`
+	Position
+	// Whether the ball has just arrived back at the queue position it started
+	// at, having left the queue since
+	Returned bool `json:"returned,omitempty"`
+}
+
+// How Trajectory follows a ball
+type TrajectoryOptions struct {
+	// Minutes to run the clock for; 0 runs until ctx is done or, with
+	// UntilReturn, until the ball returns
+	Minutes uint64
+	// Only report the minutes at which the ball changed holders or returned,
+	// rather than every minute
+	Transitions bool
+	// Stop once the ball returns to its starting queue position
+	UntilReturn bool
+}
+
+// Run the clock, following ball id and calling emit with where it is: first
+// where it starts, then after every minute (or, per opts, every transition).
+// An error from emit or, on every minute, ctx stops the run and is returned.
+func (c *Clock) Trajectory(ctx context.Context, id int, opts TrajectoryOptions,
+	emit func(TrajectoryPoint) error) error {
+	pos, ok := c.State().Find(id)
+	if !ok {
+		return fmt.Errorf("No ball %d", id)
+	}
+	// a ball starting on a rail has no queue position to return to
+	start := pos
+	left := start.Holder != "Main"
+	if err := emit(TrajectoryPoint{c.nMinutes, c.TimeString(), pos, false}); err != nil {
+		return err
+	}
+	for i := uint64(0); opts.Minutes == 0 || i < opts.Minutes; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.Step()
+		prev := pos
+		pos, _ = c.State().Find(id)
+		// a ball only moves back in the queue by leaving it, even if it tips
+		// every rail and returns within the minute
+		moved := pos.Holder != prev.Holder || pos.Index > prev.Index
+		left = left || moved
+		returned := start.Holder == "Main" && left && pos == start
+		if returned {
+			left = false
+		}
+		if opts.Transitions && !moved && !returned {
+			continue
+		}
+		if err := emit(TrajectoryPoint{c.nMinutes, c.TimeString(), pos, returned}); err != nil {
+			return err
+		}
+		if returned && opts.UntilReturn {
+			return nil
+		}
+	}
+	return nil
+}
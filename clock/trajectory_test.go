@@ -0,0 +1,97 @@
+package clock
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	s := State{Min: []int{3}, FiveMin: []int{}, Hour: []int{0, 2}, Main: []int{4, 1}}
+	for id, expected := range map[int]Position{
+		3: {"Min", 0},
+		2: {"Hour", 1},
+		1: {"Main", 1},
+	} {
+		if actual, ok := s.Find(id); !ok || actual != expected {
+			t.Errorf("Unexpected position of ball %d (actual %+v, expected %+v)", id, actual, expected)
+		}
+	}
+	if _, ok := s.Find(5); ok {
+		t.Errorf("Expected ball 5 not to be found")
+	}
+}
+
+func collectTrajectory(t *testing.T, c *Clock, id int, opts TrajectoryOptions) []TrajectoryPoint {
+	var points []TrajectoryPoint
+	err := c.Trajectory(context.Background(), id, opts, func(p TrajectoryPoint) error {
+		points = append(points, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return points
+}
+
+func TestTrajectory(t *testing.T) {
+	every := collectTrajectory(t, New(30), 4, TrajectoryOptions{Minutes: 1440})
+	if len(every) != 1441 {
+		t.Fatalf("Unexpected number of points (actual %d, expected %d)", len(every), 1441)
+	}
+	check := New(30)
+	for i, p := range every {
+		if i > 0 {
+			check.Step()
+		}
+		expected, _ := check.State().Find(4)
+		if p.Minute != check.Minutes() || p.Time != check.TimeString() || p.Position != expected {
+			t.Fatalf("Unexpected point %+v at minute %d (expected %+v)", p, check.Minutes(), expected)
+		}
+	}
+	// ball 4 drops fifth and tips the one minute rail onto the five minute
+	// rail
+	if every[5].Position != (Position{"FiveMin", 0}) {
+		t.Errorf("Unexpected position at minute 5: %+v", every[5].Position)
+	}
+
+	transitions := collectTrajectory(t, New(30), 4, TrajectoryOptions{Minutes: 1440, Transitions: true})
+	j := 0
+	for i, p := range every {
+		if i > 0 && p.Holder == every[i-1].Holder && p.Index <= every[i-1].Index && !p.Returned {
+			continue
+		}
+		if j >= len(transitions) || transitions[j] != p {
+			t.Fatalf("Unexpected transitions at minute %d: %+v", p.Minute, transitions)
+		}
+		j++
+	}
+	if j != len(transitions) {
+		t.Errorf("Unexpected extra transitions: %+v", transitions[j:])
+	}
+}
+
+func TestTrajectoryUntilReturn(t *testing.T) {
+	points := collectTrajectory(t, New(30), 7, TrajectoryOptions{UntilReturn: true})
+	last := points[len(points)-1]
+	if !last.Returned || last.Position != (Position{"Main", 7}) {
+		t.Errorf("Expected the last point to be the return: %+v", last)
+	}
+	for _, p := range points[:len(points)-1] {
+		if p.Returned {
+			t.Errorf("Unexpected return at minute %d", p.Minute)
+		}
+	}
+
+	// a ball which starts on a rail never returns
+	c := New(30)
+	c.Step()
+	points = collectTrajectory(t, c, 0, TrajectoryOptions{Minutes: 1440, UntilReturn: true})
+	if len(points) != 1441 {
+		t.Errorf("Unexpected number of points (actual %d, expected %d)", len(points), 1441)
+	}
+
+	if err := New(30).Trajectory(context.Background(), 30, TrajectoryOptions{},
+		func(TrajectoryPoint) error { return nil }); err == nil {
+		t.Errorf("Expected an error for a missing ball")
+	}
+}
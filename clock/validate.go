@@ -0,0 +1,90 @@
+package clock
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Return an error describing how s is not a state a clock could be in: every
+// ball ID from 0 up to the number of balls must appear exactly once, and no
+// rail may hold more than its capacity.
+func Validate(s State) error {
+	if err := CheckBallCount(uint64(s.NBalls())); err != nil {
+		return err
+	}
+	return validateIds(s)
+}
+
+// Validate s without checking the number of balls is in the classic range
+func validateIds(s State) error {
+	nBalls := s.NBalls()
+	seen := make([]bool, nBalls)
+	for _, h := range []struct {
+		name     string
+		ids      []int
+		capacity int
+	}{
+		{"Min", s.Min, ONE_MIN_RAIL_CAP},
+		{"FiveMin", s.FiveMin, FIVE_MIN_RAIL_CAP},
+		{"Hour", s.Hour, HOUR_RAIL_CAP},
+		{"Main", s.Main, nBalls},
+	} {
+		if len(h.ids) > h.capacity {
+			return fmt.Errorf("Too many balls in %s, %d > %d", h.name, len(h.ids), h.capacity)
+		}
+		for _, id := range h.ids {
+			if id < 0 || id >= nBalls {
+				return fmt.Errorf("Ball ID %d in %s out of range [0, %d)", id, h.name, nBalls)
+			}
+			if seen[id] {
+				return fmt.Errorf("Ball %d appears more than once", id)
+			}
+			seen[id] = true
+		}
+	}
+	return nil
+}
+
+// Return an error describing how the clock is inconsistent: its ball holders'
+// bookkeeping is checked, then that it still holds every ball it started
+// with, then its state is validated.
+func (c *Clock) Validate() error {
+	if err := c.mech.check(); err != nil {
+		return err
+	}
+	s := c.State()
+	if nBalls := s.NBalls(); nBalls < c.mech.capacity() {
+		var missing []int
+		for id := 0; id < c.mech.capacity(); id++ {
+			if _, ok := s.Find(id); !ok {
+				missing = append(missing, id)
+			}
+		}
+		return fmt.Errorf("Holding %d balls, expected %d (missing %v)",
+			nBalls, c.mech.capacity(), missing)
+	}
+	return validateIds(s)
+}
+
+// Describe the change from one state to another, one ball holder per line,
+// marking the holders that changed
+func diffStates(before State, after State) string {
+	var b strings.Builder
+	for _, h := range []struct {
+		name          string
+		before, after []int
+	}{
+		{"Min", before.Min, after.Min},
+		{"FiveMin", before.FiveMin, after.FiveMin},
+		{"Hour", before.Hour, after.Hour},
+		{"Main", before.Main, after.Main},
+	} {
+		was, now := fmt.Sprint(h.before), fmt.Sprint(h.after)
+		if was == now {
+			fmt.Fprintf(&b, "  %-7s %s\n", h.name, now)
+		} else {
+			fmt.Fprintf(&b, "* %-7s %s -> %s\n", h.name, was, now)
+		}
+	}
+	return b.String()
+}
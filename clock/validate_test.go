@@ -0,0 +1,67 @@
+package clock
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	s := NewAfter(30, 100).State()
+	if err := Validate(s); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	s.Main[0] = s.Hour[0]
+	if err := Validate(s); err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("Expected an error for a repeated ball, got %v", err)
+	}
+	s.Main[0] = 30
+	if err := Validate(s); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("Expected an error for an out of range ball, got %v", err)
+	}
+	s.Main = s.Main[:10]
+	if err := Validate(s); err == nil {
+		t.Errorf("Expected an error for too few balls")
+	}
+}
+
+func TestClockValidate(t *testing.T) {
+	c := New(30)
+	for i := 0; i < 1440; i++ {
+		c.Step()
+		if err := c.Validate(); err != nil {
+			t.Fatalf("Unexpected error at minute %d: %s", c.Minutes(), err.Error())
+		}
+	}
+	narrow(c).queue.Pop()
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "missing [6]") {
+		t.Errorf("Expected an error for a lost ball, got %v", err)
+	}
+}
+
+func TestDebug(t *testing.T) {
+	c := New(30)
+	c.SetDebug(true)
+	if days, err := c.DaysUntilCycle(context.Background(), nil); err != nil || days != 15 {
+		t.Errorf("Unexpected result (days %d, error %v)", days, err)
+	}
+
+	// a ball lost from the queue
+	c = New(30)
+	c.SetDebug(true)
+	narrow(c).queue.Pop()
+	_, err := c.DaysUntilCycle(context.Background(), nil)
+	if err == nil {
+		t.Fatalf("Expected an invariant to break")
+	}
+	msg := err.Error()
+	for _, expected := range []string{
+		"Invariant broken at minute 1: Holding 29 balls, expected 30 (missing [0])\n",
+		"* Min     [] -> [1]\n",
+		"  Hour    []\n",
+	} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("Expected %q in error:\n%s", expected, msg)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/bgmerrell/goballclock/clock"
+	"io"
+	"os"
+)
+
+// Work out how long a fresh clock must run to reach a state read as JSON from
+// a file or stdin
+func elapsed(args []string) error {
+	fs := flag.NewFlagSet("elapsed", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: elapsed [FILE]\n\n"+
+			"Read a clock state, e.g. {\"Min\": [...], \"FiveMin\": [...], \"Hour\": [...], \"Main\": [...]},\n"+
+			"from FILE or stdin and print the fewest minutes a fresh clock takes to reach it.\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var in io.Reader = os.Stdin
+	if fs.NArg() > 0 {
+		file, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	var s clock.State
+	if err := json.NewDecoder(in).Decode(&s); err != nil {
+		err = fmt.Errorf("Malformed input (%s)", err.Error())
+		fmt.Fprintln(os.Stderr, err.Error())
+		return err
+	}
+	minutes, err := clock.ElapsedMinutes(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Impossible state (%s)\n", err.Error())
+		return err
+	}
+	fmt.Printf("%s after %d minutes (%d days, %d minutes)\n",
+		s.TimeString(), minutes, minutes/1440, minutes%1440)
+	return nil
+}
@@ -0,0 +1,234 @@
+/*
+long-running computations
+
+A Manager runs submitted computations in the background, at most a fixed
+number at a time.  Each computation gets an ID which can be used to poll its
+progress, wait for it, or cancel it.  Finished computations are kept around
+for a configurable period so that their results can be collected.
+*/
+package jobs
+
+import (
+	"context"
+	"errors"
+	"github.com/bgmerrell/goballclock/clock"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	QUEUED    Status = "queued"
+	RUNNING   Status = "running"
+	DONE      Status = "done"
+	FAILED    Status = "failed"
+	CANCELLED Status = "cancelled"
+)
+
+var ErrNoSuchJob = errors.New("No such job")
+
+// How far along a computation is
+type Progress struct {
+	// minutes simulated
+	Minutes uint64 `json:"minutes"`
+	// clock refreshes counted
+	Refreshes uint64 `json:"refreshes"`
+}
+
+// A snapshot of a job
+type Job struct {
+	Id        string      `json:"id"`
+	Status    Status      `json:"status"`
+	Progress  Progress    `json:"progress"`
+	Result    interface{} `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Submitted time.Time   `json:"submitted"`
+	Finished  time.Time   `json:"finished,omitzero"`
+}
+
+// A computation.  It should return ctx's error soon after ctx is done, and
+// may report its progress as often as it likes.
+type Func func(ctx context.Context, progress func(Progress)) (interface{}, error)
+
+// The result of a Cycle computation
+type CycleResult struct {
+	Balls uint8  `json:"balls"`
+	Days  uint64 `json:"days"`
+}
+
+// A computation of the days until nBalls balls cycle
+func Cycle(nBalls uint8) Func {
+	return cycle(nBalls, false)
+}
+
+// Like Cycle, but validating the clock after every minute.  See
+// clock.Clock.SetDebug.
+func CycleChecked(nBalls uint8) Func {
+	return cycle(nBalls, true)
+}
+
+func cycle(nBalls uint8, debug bool) Func {
+	return func(ctx context.Context, progress func(Progress)) (interface{}, error) {
+		c := clock.New(nBalls)
+		c.SetDebug(debug)
+		days, err := c.DaysUntilCycle(ctx,
+			func(minutes uint64, refreshes uint64) {
+				progress(Progress{minutes, refreshes})
+			})
+		if err != nil {
+			return nil, err
+		}
+		return CycleResult{nBalls, days}, nil
+	}
+}
+
+type job struct {
+	Job
+	cancel context.CancelFunc
+	// closed when the job finishes
+	done chan struct{}
+}
+
+// Runs jobs with bounded concurrency
+type Manager struct {
+	// holds a token for every running job
+	sem chan struct{}
+	// how long finished jobs are kept; zero or less keeps them forever
+	retention time.Duration
+	jobs      map[string]*job
+	nextId    uint64
+	mu        sync.Mutex
+	now       func() time.Time
+}
+
+// Create a new Manager which runs at most concurrency jobs at once and keeps
+// finished jobs for retention
+func NewManager(concurrency int, retention time.Duration) *Manager {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Manager{
+		sem:       make(chan struct{}, concurrency),
+		retention: retention,
+		jobs:      make(map[string]*job),
+		now:       time.Now,
+	}
+}
+
+// Queue f to run and return its job ID
+func (m *Manager) Submit(f Func) string {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m.mu.Lock()
+	m.expire()
+	m.nextId++
+	j := &job{
+		Job:    Job{Id: strconv.FormatUint(m.nextId, 10), Status: QUEUED, Submitted: m.now()},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	m.jobs[j.Id] = j
+	m.mu.Unlock()
+
+	go m.run(ctx, j, f)
+	return j.Id
+}
+
+// Wait for a slot, then run f
+func (m *Manager) run(ctx context.Context, j *job, f Func) {
+	select {
+	case m.sem <- struct{}{}:
+	case <-ctx.Done():
+		m.finish(j, nil, ctx.Err())
+		return
+	}
+	defer func() { <-m.sem }()
+
+	m.mu.Lock()
+	j.Status = RUNNING
+	m.mu.Unlock()
+
+	result, err := f(ctx, func(p Progress) {
+		m.mu.Lock()
+		j.Progress = p
+		m.mu.Unlock()
+	})
+	m.finish(j, result, err)
+}
+
+func (m *Manager) finish(j *job, result interface{}, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case errors.Is(err, context.Canceled):
+		j.Status = CANCELLED
+	case err != nil:
+		j.Status = FAILED
+		j.Error = err.Error()
+	default:
+		j.Status = DONE
+		j.Result = result
+	}
+	j.Finished = m.now()
+	j.cancel()
+	close(j.done)
+}
+
+// Forget finished jobs older than the retention period.  m.mu must be held.
+func (m *Manager) expire() {
+	if m.retention <= 0 {
+		return
+	}
+	now := m.now()
+	for id, j := range m.jobs {
+		if !j.Finished.IsZero() && now.Sub(j.Finished) > m.retention {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// Return a snapshot of a job.  false is returned if there is no such job.
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return j.Job, true
+}
+
+// Cancel a queued or running job.  false is returned if there is no such
+// job.  Cancelling a finished job has no effect.
+func (m *Manager) Cancel(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+	j, ok := m.jobs[id]
+	if ok {
+		j.cancel()
+	}
+	return ok
+}
+
+// Wait for a job to finish and return its final snapshot.  If ctx is done
+// first, ctx's error is returned and the job is left running.
+func (m *Manager) Wait(ctx context.Context, id string) (Job, error) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return Job{}, ErrNoSuchJob
+	}
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+		return Job{}, ctx.Err()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return j.Job, nil
+}
@@ -0,0 +1,112 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// A computation which reports some progress and then blocks until it is
+// released or cancelled
+func blocker(started chan<- struct{}, release <-chan struct{}) Func {
+	return func(ctx context.Context, progress func(Progress)) (interface{}, error) {
+		progress(Progress{720, 1})
+		started <- struct{}{}
+		select {
+		case <-release:
+			return "released", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func TestCycleJob(t *testing.T) {
+	m := NewManager(2, time.Hour)
+	id := m.Submit(Cycle(45))
+	j, err := m.Wait(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Unexpected error waiting for job: %s", err.Error())
+	}
+	if j.Status != DONE {
+		t.Fatalf("Unexpected status (actual %s, expected %s)", j.Status, DONE)
+	}
+	expected := "{45 378}"
+	if fmt.Sprintf("%v", j.Result) != expected {
+		t.Errorf("Unexpected result (actual %v, expected %s)", j.Result, expected)
+	}
+	if j.Progress.Refreshes == 0 || j.Progress.Minutes != j.Progress.Refreshes*720 {
+		t.Errorf("Unexpected progress: %+v", j.Progress)
+	}
+}
+
+func TestCycleCheckedJob(t *testing.T) {
+	m := NewManager(1, time.Hour)
+	j, err := m.Wait(context.Background(), m.Submit(CycleChecked(30)))
+	if err != nil {
+		t.Fatalf("Unexpected error waiting for job: %s", err.Error())
+	}
+	if j.Status != DONE || fmt.Sprintf("%v", j.Result) != "{30 15}" {
+		t.Errorf("Unexpected job: %+v", j)
+	}
+}
+
+func TestConcurrencyAndCancel(t *testing.T) {
+	m := NewManager(1, time.Hour)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	first := m.Submit(blocker(started, release))
+	<-started
+	second := m.Submit(blocker(started, release))
+
+	j, _ := m.Get(first)
+	if j.Status != RUNNING || j.Progress.Minutes != 720 {
+		t.Errorf("Unexpected first job: %+v", j)
+	}
+	// Only one job may run at a time
+	j, _ = m.Get(second)
+	if j.Status != QUEUED {
+		t.Errorf("Unexpected status (actual %s, expected %s)", j.Status, QUEUED)
+	}
+
+	if !m.Cancel(first) {
+		t.Fatalf("Failed to cancel job %s", first)
+	}
+	j, _ = m.Wait(context.Background(), first)
+	if j.Status != CANCELLED {
+		t.Errorf("Unexpected status (actual %s, expected %s)", j.Status, CANCELLED)
+	}
+
+	// Cancelling the first job frees the slot for the second
+	<-started
+	close(release)
+	j, _ = m.Wait(context.Background(), second)
+	if j.Status != DONE || j.Result != "released" {
+		t.Errorf("Unexpected second job: %+v", j)
+	}
+
+	if m.Cancel("nosuchjob") {
+		t.Errorf("Unexpected cancellation of a job that does not exist")
+	}
+	if _, err := m.Wait(context.Background(), "nosuchjob"); err != ErrNoSuchJob {
+		t.Errorf("Unexpected error (actual %v, expected %v)", err, ErrNoSuchJob)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	m := NewManager(1, time.Minute)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	id := m.Submit(Cycle(30))
+	m.Wait(context.Background(), id)
+
+	now = now.Add(time.Minute)
+	if _, ok := m.Get(id); !ok {
+		t.Errorf("Expected job %s to be retained", id)
+	}
+	now = now.Add(time.Second)
+	if _, ok := m.Get(id); ok {
+		t.Errorf("Expected job %s to have expired", id)
+	}
+}
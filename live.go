@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/bgmerrell/goballclock/clock"
+	"github.com/bgmerrell/goballclock/render"
+	"math"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Bounds of the speed, so that a minute's tick is a sensible duration
+const MIN_LIVE_SPEED = 0.001
+const MAX_LIVE_SPEED = 10000.0
+
+// What live mode saves so that a restarted process can resume.  Only the
+// balls' IDs are saved, so a resumed clock's balls start with no lifts or
+// attributes.
+type liveState struct {
+	// When the clock last advanced
+	At    time.Time   `json:"at"`
+	Stats clock.Stats `json:"stats"`
+	State clock.State `json:"state"`
+}
+
+// Load a saved clock.  If the file does not exist, nil is returned with no
+// error.
+func loadLiveState(path string) (*clock.Clock, time.Time, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, time.Time{}, nil
+	} else if err != nil {
+		return nil, time.Time{}, err
+	}
+	var ls liveState
+	if err = json.Unmarshal(data, &ls); err != nil {
+		return nil, time.Time{}, fmt.Errorf("Malformed state file %s (%s)", path, err.Error())
+	}
+	c, err := clock.FromState(ls.State, ls.Stats)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("Malformed state file %s (%s)", path, err.Error())
+	}
+	return c, ls.At, nil
+}
+
+// Save a clock, replacing the file atomically so a crash cannot leave half a
+// state behind
+func saveLiveState(path string, c *clock.Clock, at time.Time) error {
+	data, err := json.Marshal(liveState{at, c.Stats(), c.State()})
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Run a clock in step with the wall clock (or faster), one ball per minute
+func live(args []string) error {
+	fs := flag.NewFlagSet("live", flag.ContinueOnError)
+	nBalls := fs.Uint64("balls", clock.MIN_BALLS, "number of balls in a new clock")
+	speed := fs.Float64("speed", 1, "clock minutes per real minute")
+	statePath := fs.String("state", "", "file to resume the clock from and save it to")
+	ansi := fs.Bool("ansi", false, "draw the clock in the terminal rather than printing a line per minute")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := clock.CheckBallCount(*nBalls); err != nil {
+		fmt.Fprintf(os.Stderr, "Malformed input (%s)\n", err.Error())
+		return err
+	}
+	if math.IsNaN(*speed) || *speed < MIN_LIVE_SPEED || *speed > MAX_LIVE_SPEED {
+		err := fmt.Errorf("Malformed input (speed must be in [%g, %g], got %g)",
+			MIN_LIVE_SPEED, MAX_LIVE_SPEED, *speed)
+		fmt.Fprintln(os.Stderr, err.Error())
+		return err
+	}
+	tick := time.Duration(float64(time.Minute) / *speed)
+
+	// Start from the saved state and catch up on the time the process was
+	// down, or start a new clock and catch up to the time of day
+	now := time.Now()
+	var c *clock.Clock
+	var base time.Time
+	if *statePath != "" {
+		var err error
+		if c, base, err = loadLiveState(*statePath); err != nil {
+			fmt.Fprintln(os.Stderr, "Error loading state:", err.Error())
+			return err
+		}
+	}
+	if c == nil {
+		// in real time, balls drop on the minute
+		base = now
+		if *speed == 1 {
+			base = now.Truncate(time.Minute)
+		}
+		c, _ = clock.SetTime(uint8(*nBalls), 0, now.Hour(), now.Minute())
+	}
+	baseMinutes := c.Minutes()
+	// the wall time at which the clock should show its current minute
+	at := func() time.Time {
+		return base.Add(time.Duration(c.Minutes()-baseMinutes) * tick)
+	}
+	catchUp := func() {
+		for !time.Now().Before(at().Add(tick)) {
+			c.Step()
+		}
+	}
+	show := func() {
+		if *ansi {
+			render.Terminal(os.Stdout, c, fmt.Sprintf("live at %gx; ^C to stop", *speed))
+			return
+		}
+		s := c.State()
+		fmt.Printf("%5s  Hour %v  FiveMin %v  Min %v\n", c.TimeString(), s.Hour, s.FiveMin, s.Min)
+	}
+	save := func() error {
+		if *statePath == "" {
+			return nil
+		}
+		err := saveLiveState(*statePath, c, at())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error saving state:", err.Error())
+		}
+		return err
+	}
+
+	catchUp()
+	show()
+	if err := save(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for {
+		timer := time.NewTimer(time.Until(at().Add(tick)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return save()
+		case <-timer.C:
+		}
+		catchUp()
+		show()
+		if err := save(); err != nil {
+			return err
+		}
+	}
+}
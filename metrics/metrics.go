@@ -0,0 +1,260 @@
+/*
+metrics in the Prometheus text exposition format
+
+Metrics are created through a Registry, which writes all of them out in
+registration order.  Only what the ball clock needs is implemented:
+counters, optionally split by one label, and histograms split by one label.
+*/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Histogram buckets suited to computation latencies, in seconds
+var DEFAULT_BUCKETS = []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 60}
+
+// Something a Registry can write out
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// A collection of metrics
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Write all metrics in the text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := append([]collector{}, r.collectors...)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Serve the metrics, e.g. at /metrics
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func writeHeader(w *bufio.Writer, name string, help string, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Format a set of label pairs, e.g. {rail="hour",le="1"}
+func formatLabels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], escaper.Replace(pairs[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// A monotonically increasing count
+type Counter struct {
+	name  string
+	help  string
+	value atomic.Uint64
+}
+
+func (r *Registry) NewCounter(name string, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	r.register(c)
+	return c
+}
+
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+func (c *Counter) Add(n uint64) {
+	c.value.Add(n)
+}
+
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.name, c.Value())
+}
+
+// Counters split by the value of one label
+type CounterVec struct {
+	name     string
+	help     string
+	label    string
+	mu       sync.Mutex
+	counters map[string]*Counter
+}
+
+func (r *Registry) NewCounterVec(name string, help string, label string) *CounterVec {
+	cv := &CounterVec{name: name, help: help, label: label, counters: make(map[string]*Counter)}
+	r.register(cv)
+	return cv
+}
+
+// Return the counter for a label value, creating it if needed
+func (cv *CounterVec) With(value string) *Counter {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	c, ok := cv.counters[value]
+	if !ok {
+		c = &Counter{name: cv.name, help: cv.help}
+		cv.counters[value] = c
+	}
+	return c
+}
+
+// Return the label values in use, sorted
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (cv *CounterVec) write(w *bufio.Writer) {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	writeHeader(w, cv.name, cv.help, "counter")
+	for _, value := range sortedKeys(cv.counters) {
+		fmt.Fprintf(w, "%s%s %d\n", cv.name, formatLabels(cv.label, value),
+			cv.counters[value].Value())
+	}
+}
+
+// A distribution of observed values
+type Histogram struct {
+	// upper bounds, increasing, not including +Inf
+	buckets []float64
+	mu      sync.Mutex
+	// counts[i] is the number of observations <= buckets[i]; the last
+	// count is for +Inf
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.counts[len(h.buckets)]++
+	h.sum += v
+	h.count++
+}
+
+// Histograms split by the value of one label
+type HistogramVec struct {
+	name       string
+	help       string
+	label      string
+	buckets    []float64
+	mu         sync.Mutex
+	histograms map[string]*Histogram
+}
+
+func (r *Registry) NewHistogramVec(name string, help string, label string, buckets []float64) *HistogramVec {
+	hv := &HistogramVec{
+		name:       name,
+		help:       help,
+		label:      label,
+		buckets:    append([]float64{}, buckets...),
+		histograms: make(map[string]*Histogram),
+	}
+	sort.Float64s(hv.buckets)
+	r.register(hv)
+	return hv
+}
+
+// Return the histogram for a label value, creating it if needed
+func (hv *HistogramVec) With(value string) *Histogram {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+	h, ok := hv.histograms[value]
+	if !ok {
+		h = &Histogram{buckets: hv.buckets, counts: make([]uint64, len(hv.buckets)+1)}
+		hv.histograms[value] = h
+	}
+	return h
+}
+
+func (hv *HistogramVec) write(w *bufio.Writer) {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+	writeHeader(w, hv.name, hv.help, "histogram")
+	for _, value := range sortedKeys(hv.histograms) {
+		h := hv.histograms[value]
+		h.mu.Lock()
+		for i, count := range h.counts {
+			bound := math.Inf(1)
+			if i < len(h.buckets) {
+				bound = h.buckets[i]
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", hv.name,
+				formatLabels(hv.label, value, "le", formatFloat(bound)), count)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", hv.name, formatLabels(hv.label, value), formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", hv.name, formatLabels(hv.label, value), h.count)
+		h.mu.Unlock()
+	}
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("things_total", "Things counted.")
+	cv := r.NewCounterVec("tips_total", "Tips by rail.", "rail")
+	hv := r.NewHistogramVec("latency_seconds", "Latency.", "balls", []float64{1, 0.5})
+
+	c.Inc()
+	c.Add(2)
+	cv.With("hour").Inc()
+	cv.With("five_min").Add(3)
+	cv.With("quote\"d").Inc()
+	hv.With("30").Observe(0.25)
+	hv.With("30").Observe(0.75)
+	hv.With("30").Observe(2)
+
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("Unexpected byte count (actual %d, expected %d)", n, buf.Len())
+	}
+	expected := `# HELP things_total Things counted.
+# TYPE things_total counter
+things_total 3
+# HELP tips_total Tips by rail.
+# TYPE tips_total counter
+tips_total{rail="five_min"} 3
+tips_total{rail="hour"} 1
+tips_total{rail="quote\"d"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{balls="30",le="0.5"} 1
+latency_seconds_bucket{balls="30",le="1"} 2
+latency_seconds_bucket{balls="30",le="+Inf"} 3
+latency_seconds_sum{balls="30"} 3
+latency_seconds_count{balls="30"} 3
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected exposition:\n"+
+			"Actual: %s\n"+
+			"Expected: %s",
+			buf.String(),
+			expected)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/bgmerrell/goballclock/clock"
+	"github.com/bgmerrell/goballclock/render"
+	"os"
+)
+
+// Validate a -from/-to range of ball counts
+func checkBallRange(from uint64, to uint64) error {
+	for _, nBalls := range []uint64{from, to} {
+		if err := clock.CheckBallCount(nBalls); err != nil {
+			return fmt.Errorf("Malformed input (%s)", err.Error())
+		}
+	}
+	if from > to {
+		return fmt.Errorf("Malformed input (empty range, %d > %d)", from, to)
+	}
+	return nil
+}
+
+// Chart days until cycle across a range of ball counts, as SVG or as a
+// terminal sparkline
+func plot(args []string) error {
+	fs := flag.NewFlagSet("plot", flag.ContinueOnError)
+	from := fs.Uint64("from", clock.MIN_BALLS, "smallest ball count")
+	to := fs.Uint64("to", clock.MAX_BALLS, "largest ball count")
+	bar := fs.Bool("bar", false, "draw a bar chart rather than a line")
+	log := fs.Bool("log", false, "use a logarithmic scale for days")
+	spark := fs.Bool("spark", false, "print a sparkline rather than SVG")
+	title := fs.String("title", "", "title of the SVG chart")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkBallRange(*from, *to); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return err
+	}
+
+	table, err := clock.CycleTable(context.Background(), uint8(*from), uint8(*to))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error computing cycles:", err.Error())
+		return err
+	}
+	if !*spark {
+		return render.Chart(os.Stdout, table, render.ChartOptions{Bar: *bar, Log: *log, Title: *title})
+	}
+
+	worst := table[0]
+	for _, c := range table {
+		if c.Days > worst.Days {
+			worst = c
+		}
+	}
+	fmt.Printf("%d-%d balls %s\n", *from, *to, render.Sparkline(table, *log))
+	fmt.Printf("longest: %d balls cycle after %d days\n", worst.Balls, worst.Days)
+	return nil
+}
@@ -0,0 +1,163 @@
+package render
+
+import (
+	"fmt"
+	"github.com/bgmerrell/goballclock/clock"
+	"io"
+	"math"
+	"strings"
+)
+
+// Options for charting days until cycle against ball count
+type ChartOptions struct {
+	// Draw bars rather than a line
+	Bar bool
+	// Use a logarithmic scale for days
+	Log bool
+	// Drawn above the chart if not empty
+	Title string
+}
+
+// Chart geometry, in pixels
+const CHART_WIDTH = 800
+const CHART_HEIGHT = 400
+const CHART_LEFT = 72
+const CHART_RIGHT = 16
+const CHART_TOP = 40
+const CHART_BOTTOM = 48
+
+// Sparkline levels, lowest first
+var SPARKS = []rune("▁▂▃▄▅▆▇█")
+
+// Map days onto [0, 1] relative to the largest value, on a linear or log
+// scale.  On a log scale days are offset by one so that zero stays at zero.
+func scaleDays(days uint64, maxDays uint64, log bool) float64 {
+	if maxDays == 0 {
+		return 0
+	}
+	if log {
+		return math.Log10(float64(days)+1) / math.Log10(float64(maxDays)+1)
+	}
+	return float64(days) / float64(maxDays)
+}
+
+func maxDays(table []clock.Cycle) uint64 {
+	var m uint64
+	for _, c := range table {
+		m = max(m, c.Days)
+	}
+	return m
+}
+
+// Return the y axis ticks: powers of ten for a log scale, otherwise about
+// five round numbers
+func yTicks(maxDays uint64, log bool) []uint64 {
+	var ticks []uint64
+	if log {
+		for t := uint64(1); t <= maxDays; t *= 10 {
+			ticks = append(ticks, t)
+		}
+		return ticks
+	}
+	step := niceStep(maxDays)
+	for t := uint64(0); t <= maxDays; t += step {
+		ticks = append(ticks, t)
+	}
+	return ticks
+}
+
+// Return the smallest of 1, 2, 5, 10, 20, 50, ... which splits maxDays into
+// at most five steps
+func niceStep(maxDays uint64) uint64 {
+	for base := uint64(1); ; base *= 10 {
+		for _, m := range []uint64{1, 2, 5} {
+			if maxDays/(base*m) <= 5 {
+				return base * m
+			}
+		}
+	}
+}
+
+// Draw days until cycle against ball count as an SVG line or bar chart
+func Chart(w io.Writer, table []clock.Cycle, opts ChartOptions) error {
+	top := maxDays(table)
+	plotWidth := float64(CHART_WIDTH - CHART_LEFT - CHART_RIGHT)
+	plotHeight := float64(CHART_HEIGHT - CHART_TOP - CHART_BOTTOM)
+	slotWidth := plotWidth / float64(max(len(table), 1))
+	x := func(i int) float64 { return CHART_LEFT + (float64(i)+0.5)*slotWidth }
+	y := func(days uint64) float64 {
+		return CHART_TOP + plotHeight*(1-scaleDays(days, top, opts.Log))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		CHART_WIDTH, CHART_HEIGHT, CHART_WIDTH, CHART_HEIGHT)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="white"/>`+"\n", CHART_WIDTH, CHART_HEIGHT)
+	if opts.Title != "" {
+		fmt.Fprintf(&b, `<text x="%d" y="24" font-size="16" font-weight="bold">%s</text>`+"\n",
+			CHART_LEFT, escapeText(opts.Title))
+	}
+
+	// axes, ticks and labels
+	bottom := float64(CHART_HEIGHT - CHART_BOTTOM)
+	fmt.Fprintf(&b, `<path d="M%d %d V%g H%d" fill="none" stroke="black"/>`+"\n",
+		CHART_LEFT, CHART_TOP, bottom, CHART_WIDTH-CHART_RIGHT)
+	for _, t := range yTicks(top, opts.Log) {
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#e0e0e0"/>`+"\n",
+			CHART_LEFT, y(t), CHART_WIDTH-CHART_RIGHT, y(t))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%d</text>`+"\n",
+			CHART_LEFT-6, y(t), t)
+	}
+	for i, c := range table {
+		if c.Balls%10 == 0 || len(table) <= 20 {
+			fmt.Fprintf(&b, `<text x="%.1f" y="%g" text-anchor="middle">%d</text>`+"\n",
+				x(i), bottom+16, c.Balls)
+		}
+	}
+	scale := "days"
+	if opts.Log {
+		scale = "days (log scale)"
+	}
+	fmt.Fprintf(&b, `<text x="%g" y="%d" text-anchor="middle">balls</text>`+"\n",
+		CHART_LEFT+plotWidth/2, CHART_HEIGHT-12)
+	fmt.Fprintf(&b, `<text x="16" y="%g" text-anchor="middle" transform="rotate(-90 16 %g)">%s</text>`+"\n",
+		CHART_TOP+plotHeight/2, CHART_TOP+plotHeight/2, scale)
+
+	// data
+	if opts.Bar {
+		for i, c := range table {
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="steelblue"><title>%d balls: %d days</title></rect>`+"\n",
+				x(i)-slotWidth*0.4, y(c.Days), slotWidth*0.8, bottom-y(c.Days), c.Balls, c.Days)
+		}
+	} else {
+		points := make([]string, len(table))
+		for i, c := range table {
+			points[i] = fmt.Sprintf("%.1f,%.1f", x(i), y(c.Days))
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="steelblue" stroke-width="2"/>`+"\n",
+			strings.Join(points, " "))
+		for i, c := range table {
+			fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="2.5" fill="steelblue"><title>%d balls: %d days</title></circle>`+"\n",
+				x(i), y(c.Days), c.Balls, c.Days)
+		}
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Escape text for inclusion in an SVG document, as text or an attribute value
+func escapeText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace(text)
+}
+
+// Return a one-line chart of days until cycle, one character per ball count
+func Sparkline(table []clock.Cycle, log bool) string {
+	top := maxDays(table)
+	var b strings.Builder
+	for _, c := range table {
+		level := int(scaleDays(c.Days, top, log) * float64(len(SPARKS)-1))
+		b.WriteRune(SPARKS[level])
+	}
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/bgmerrell/goballclock/clock"
+	"strings"
+	"testing"
+)
+
+var testTable = []clock.Cycle{{Balls: 30, Days: 15}, {Balls: 31, Days: 85}, {Balls: 32, Days: 65}, {Balls: 33, Days: 138}, {Balls: 34, Days: 1}}
+
+func TestChart(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Chart(&buf, testTable, ChartOptions{Title: "Cycles <30-34>"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		"<polyline",
+		"<title>33 balls: 138 days</title>",
+		"Cycles &lt;30-34&gt;",
+		">100</text>",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected chart to contain %q:\n%s", expected, out)
+		}
+	}
+
+	buf.Reset()
+	Chart(&buf, testTable, ChartOptions{Bar: true, Log: true})
+	out = buf.String()
+	if n := strings.Count(out, "<rect"); n != len(testTable)+1 {
+		t.Errorf("Unexpected number of rects (actual %d, expected %d)", n, len(testTable)+1)
+	}
+	if !strings.Contains(out, "days (log scale)") || !strings.Contains(out, ">100</text>") {
+		t.Errorf("Expected a log scale:\n%s", out)
+	}
+}
+
+func TestYTicks(t *testing.T) {
+	for _, tc := range []struct {
+		maxDays  uint64
+		log      bool
+		expected string
+	}{
+		{138, false, "[0 50 100]"},
+		{108855, false, "[0 20000 40000 60000 80000 100000]"},
+		{108855, true, "[1 10 100 1000 10000 100000]"},
+		{3, false, "[0 1 2 3]"},
+	} {
+		actual := fmt.Sprintf("%v", yTicks(tc.maxDays, tc.log))
+		if actual != tc.expected {
+			t.Errorf("Unexpected ticks for %d (actual %s, expected %s)", tc.maxDays, actual, tc.expected)
+		}
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	actual := Sparkline(testTable, false)
+	expected := "▁▅▄█▁"
+	if actual != expected {
+		t.Errorf("Unexpected sparkline (actual %s, expected %s)", actual, expected)
+	}
+	actual = Sparkline(testTable, true)
+	expected = "▄▇▆█▁"
+	if actual != expected {
+		t.Errorf("Unexpected log sparkline (actual %s, expected %s)", actual, expected)
+	}
+}
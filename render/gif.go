@@ -0,0 +1,223 @@
+package render
+
+import (
+	"fmt"
+	"github.com/bgmerrell/goballclock/clock"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+)
+
+// Options for exporting a clock run as an animated GIF
+type GIFOptions struct {
+	// Minutes to run the clock before the first frame
+	Start uint64
+	// Minutes to run the clock while recording
+	Minutes uint64
+	// Record a frame only when a rail tips, rather than every minute
+	PerTip bool
+	// Frames per second; DEFAULT_GIF_FPS if zero
+	FPS int
+	// Colour balls by ID rather than drawing them all the same colour
+	Color bool
+	// Ring the ball which tipped a rail in the frame's minute
+	Highlight bool
+}
+
+const DEFAULT_GIF_FPS = 10
+
+// Frames are kept in memory until the GIF is encoded
+const MAX_GIF_FRAMES = 1000
+
+// Palette indices of the fixed colours; ball hues follow
+const (
+	BG_INDEX = iota
+	EMPTY_INDEX
+	OUTLINE_INDEX
+	TEXT_INDEX
+	HIGHLIGHT_INDEX
+	BALL_INDEX
+	N_FIXED_COLORS
+)
+
+// The GIF palette holds 256 colours
+const N_HUES = 256 - N_FIXED_COLORS
+
+// A 3x5 pixel font for ball IDs and the time; each row is 3 bits, high bit
+// on the left
+var glyphs = map[rune][5]uint8{
+	'0': {7, 5, 5, 5, 7},
+	'1': {2, 6, 2, 2, 7},
+	'2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7},
+	'7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7},
+	':': {0, 2, 0, 2, 0},
+}
+
+// Convert an HSV colour (h in [0, 360), s and v in [0, 1]) to RGB
+func hsv(h float64, s float64, v float64) color.RGBA {
+	c := v * s
+	hp := h / 60
+	x := c * (1 - abs(mod2(hp)-1))
+	var r, g, b float64
+	switch int(hp) {
+	case 0:
+		r, g, b = c, x, 0
+	case 1:
+		r, g, b = x, c, 0
+	case 2:
+		r, g, b = 0, c, x
+	case 3:
+		r, g, b = 0, x, c
+	case 4:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	m := v - c
+	return color.RGBA{uint8((r + m) * 255), uint8((g + m) * 255), uint8((b + m) * 255), 255}
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
+
+// f modulo 2
+func mod2(f float64) float64 {
+	return f - 2*float64(int(f/2))
+}
+
+// Build the palette: the fixed colours, then a hue per ball (or per group of
+// balls, if there are more balls than hues)
+func gifPalette(nBalls int) color.Palette {
+	p := color.Palette{
+		BG_INDEX:        color.White,
+		EMPTY_INDEX:     color.RGBA{0xd0, 0xd0, 0xd0, 0xff},
+		OUTLINE_INDEX:   color.RGBA{0x40, 0x40, 0x40, 0xff},
+		TEXT_INDEX:      color.Black,
+		HIGHLIGHT_INDEX: color.RGBA{0xe0, 0x20, 0x20, 0xff},
+		BALL_INDEX:      color.RGBA{0xc0, 0xc0, 0xc0, 0xff},
+	}
+	for i := 0; i < min(nBalls, N_HUES); i++ {
+		p = append(p, hsv(float64(i)*360/float64(min(nBalls, N_HUES)), 0.45, 0.95))
+	}
+	return p
+}
+
+// Draw text with the pixel font, scaled by scale, centred on (x, y)
+func drawText(img *image.Paletted, x int, y int, text string, scale int) {
+	width := (len(text)*4 - 1) * scale
+	x -= width / 2
+	y -= 5 * scale / 2
+	for _, r := range text {
+		for row, bits := range glyphs[r] {
+			for col := 0; col < 3; col++ {
+				if bits&(4>>col) == 0 {
+					continue
+				}
+				for dy := 0; dy < scale; dy++ {
+					for dx := 0; dx < scale; dx++ {
+						img.SetColorIndex(x+col*scale+dx, y+row*scale+dy, TEXT_INDEX)
+					}
+				}
+			}
+		}
+		x += 4 * scale
+	}
+}
+
+// Draw a disc of radius r, and a ring of the given width and colour around
+// its edge
+func drawBall(img *image.Paletted, cx int, cy int, r int, fill uint8, ring uint8, ringWidth int) {
+	for y := -r; y <= r; y++ {
+		for x := -r; x <= r; x++ {
+			d := x*x + y*y
+			if d > r*r {
+				continue
+			}
+			if d > (r-ringWidth)*(r-ringWidth) {
+				img.SetColorIndex(cx+x, cy+y, ring)
+			} else {
+				img.SetColorIndex(cx+x, cy+y, fill)
+			}
+		}
+	}
+}
+
+// Draw one frame of the clock.  highlight is the ID of a ball to ring, or -1.
+func gifFrame(s clock.State, palette color.Palette, opts GIFOptions, highlight int) *image.Paletted {
+	slots, _, width, height := layout(s)
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	drawText(img, MARGIN+LABEL_WIDTH/2, MARGIN+HEADER_HEIGHT/2, s.TimeString(), 3)
+	r := SLOT_SIZE/2 - 2
+	for _, sl := range slots {
+		if sl.id == -1 {
+			drawBall(img, sl.x, sl.y, r, BG_INDEX, EMPTY_INDEX, 1)
+			continue
+		}
+		fill := uint8(BALL_INDEX)
+		if opts.Color {
+			fill = uint8(N_FIXED_COLORS + sl.id%N_HUES)
+		}
+		if sl.id == highlight {
+			drawBall(img, sl.x, sl.y, r, fill, HIGHLIGHT_INDEX, 4)
+		} else {
+			drawBall(img, sl.x, sl.y, r, fill, OUTLINE_INDEX, 1)
+		}
+		drawText(img, sl.x, sl.y, fmt.Sprint(sl.id), 2)
+	}
+	return img
+}
+
+// Run a clock of nBalls balls and encode its queue and rails as an animated
+// GIF, one frame for the starting state and then one per minute (or per rail
+// tip).  The GIF loops forever.
+func GIF(w io.Writer, nBalls uint8, opts GIFOptions) error {
+	fps := opts.FPS
+	if fps == 0 {
+		fps = DEFAULT_GIF_FPS
+	}
+	if fps < 1 || fps > 100 {
+		return fmt.Errorf("Frame rate must be in [1, 100], got %d", fps)
+	}
+	delay := 100 / fps
+
+	c := clock.NewAfter(nBalls, opts.Start)
+	palette := gifPalette(int(nBalls))
+	anim := &gif.GIF{}
+	addFrame := func(highlight int) error {
+		if len(anim.Image) == MAX_GIF_FRAMES {
+			return fmt.Errorf("Too many frames, more than %d", MAX_GIF_FRAMES)
+		}
+		anim.Image = append(anim.Image, gifFrame(c.State(), palette, opts, highlight))
+		anim.Delay = append(anim.Delay, delay)
+		return nil
+	}
+
+	if err := addFrame(-1); err != nil {
+		return err
+	}
+	for i := uint64(0); i < opts.Minutes; i++ {
+		move := c.Step()
+		if opts.PerTip && move.Tips == 0 {
+			continue
+		}
+		highlight := -1
+		if opts.Highlight && move.Tips > 0 {
+			highlight = move.Ball
+		}
+		if err := addFrame(highlight); err != nil {
+			return err
+		}
+	}
+	return gif.EncodeAll(w, anim)
+}
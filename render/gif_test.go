@@ -0,0 +1,57 @@
+package render
+
+import (
+	"bytes"
+	"image/gif"
+	"testing"
+)
+
+func TestGIF(t *testing.T) {
+	var buf bytes.Buffer
+	err := GIF(&buf, 30, GIFOptions{Start: 55, Minutes: 10, FPS: 20, Color: true, Highlight: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("Failed to decode GIF: %s", err.Error())
+	}
+	// The starting frame, then one per minute
+	if len(anim.Image) != 11 {
+		t.Errorf("Unexpected number of frames (actual %d, expected %d)", len(anim.Image), 11)
+	}
+	for i, delay := range anim.Delay {
+		if delay != 5 {
+			t.Errorf("Unexpected delay of frame %d (actual %d, expected %d)", i, delay, 5)
+		}
+	}
+
+	// Minute 60 tips two rails, and minute 65 tips one
+	buf.Reset()
+	GIF(&buf, 30, GIFOptions{Start: 55, Minutes: 10, PerTip: true, Highlight: true})
+	anim, err = gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("Failed to decode GIF: %s", err.Error())
+	}
+	if len(anim.Image) != 3 {
+		t.Errorf("Unexpected number of frames (actual %d, expected %d)", len(anim.Image), 3)
+	}
+	// Highlighted frames use the highlight colour
+	found := false
+	for _, idx := range anim.Image[1].Pix {
+		if idx == HIGHLIGHT_INDEX {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Errorf("Expected the tipping ball to be highlighted")
+	}
+
+	if err = GIF(&buf, 30, GIFOptions{Minutes: MAX_GIF_FRAMES}); err == nil {
+		t.Errorf("Expected an error for too many frames")
+	}
+	if err = GIF(&buf, 30, GIFOptions{FPS: 101}); err == nil {
+		t.Errorf("Expected an error for a bad frame rate")
+	}
+}
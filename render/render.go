@@ -0,0 +1,124 @@
+/*
+pictures of the ball clock
+
+Renderers draw the queue and rails of a clock, either as ANSI text for a
+terminal, as an SVG picture, or as an animated GIF of a run.
+*/
+package render
+
+import (
+	"fmt"
+	"github.com/bgmerrell/goballclock/clock"
+	"io"
+	"strings"
+)
+
+// ANSI escape sequences
+const CLEAR_SCREEN = "\x1b[H\x1b[2J"
+const BOLD = "\x1b[1m"
+const DIM = "\x1b[2m"
+const RESET = "\x1b[0m"
+
+// How many queue balls are drawn per line
+const QUEUE_WIDTH = 16
+
+// Draw a row of ball holder slots: the IDs of balls, then capacity-len(ids)
+// empty slots
+func writeSlots(w io.Writer, ids []int, capacity int) {
+	for _, id := range ids {
+		fmt.Fprintf(w, " %3d", id)
+	}
+	if capacity > len(ids) {
+		fmt.Fprint(w, DIM+strings.Repeat("   .", capacity-len(ids))+RESET)
+	}
+}
+
+// Draw a clock as ANSI text, replacing the contents of the terminal.  status
+// is shown under the clock.
+func Terminal(w io.Writer, c *clock.Clock, status string) {
+	s := c.State()
+	nBalls := s.NBalls()
+	fmt.Fprint(w, CLEAR_SCREEN)
+	fmt.Fprintf(w, BOLD+"%s"+RESET+"  %d balls, minute %d, %d refreshes\n\n",
+		c.TimeString(), nBalls, c.Minutes(), c.Refreshes())
+
+	for _, rail := range []struct {
+		name     string
+		ids      []int
+		capacity int
+	}{
+		{"Hour   ", s.Hour, clock.HOUR_RAIL_CAP},
+		{"FiveMin", s.FiveMin, clock.FIVE_MIN_RAIL_CAP},
+		{"Min    ", s.Min, clock.ONE_MIN_RAIL_CAP},
+	} {
+		fmt.Fprint(w, rail.name)
+		writeSlots(w, rail.ids, rail.capacity)
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w)
+	for i := 0; i < nBalls; i += QUEUE_WIDTH {
+		if i == 0 {
+			fmt.Fprint(w, "Main   ")
+		} else {
+			fmt.Fprint(w, "       ")
+		}
+		end := min(i+QUEUE_WIDTH, nBalls)
+		var ids []int
+		if i < len(s.Main) {
+			ids = s.Main[i:min(end, len(s.Main))]
+		}
+		writeSlots(w, ids, end-i)
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "\n%s\n", status)
+}
+
+// Picture geometry, in pixels
+const SLOT_SIZE = 32
+const MARGIN = 16
+const LABEL_WIDTH = 80
+const HEADER_HEIGHT = 32
+
+// Where a ball holder slot is drawn
+type slot struct {
+	// center of the slot
+	x int
+	y int
+	// ID of the ball in the slot, -1 if empty
+	id int
+}
+
+// The name of a ball holder and where it is drawn
+type holderLabel struct {
+	x    int
+	y    int
+	text string
+}
+
+// Lay out the slots of the rails and the queue: one row per rail, then as
+// many rows as the queue needs, QUEUE_WIDTH slots to a row.  The size of the
+// whole picture is returned too.
+func layout(s clock.State) (slots []slot, labels []holderLabel, width int, height int) {
+	y := MARGIN + HEADER_HEIGHT
+	row := func(name string, ids []int, capacity int) {
+		labels = append(labels, holderLabel{MARGIN, y + SLOT_SIZE/2, name})
+		for i := 0; i < capacity; i++ {
+			if i > 0 && i%QUEUE_WIDTH == 0 {
+				y += SLOT_SIZE
+			}
+			id := -1
+			if i < len(ids) {
+				id = ids[i]
+			}
+			x := MARGIN + LABEL_WIDTH + (i%QUEUE_WIDTH)*SLOT_SIZE + SLOT_SIZE/2
+			slots = append(slots, slot{x, y + SLOT_SIZE/2, id})
+		}
+		y += SLOT_SIZE + SLOT_SIZE/4
+	}
+	row("Hour", s.Hour, clock.HOUR_RAIL_CAP)
+	row("FiveMin", s.FiveMin, clock.FIVE_MIN_RAIL_CAP)
+	row("Min", s.Min, clock.ONE_MIN_RAIL_CAP)
+	row("Main", s.Main, s.NBalls())
+	return slots, labels, MARGIN*2 + LABEL_WIDTH + QUEUE_WIDTH*SLOT_SIZE, y + MARGIN
+}
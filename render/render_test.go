@@ -0,0 +1,36 @@
+package render
+
+import (
+	"bytes"
+	"github.com/bgmerrell/goballclock/clock"
+	"strings"
+	"testing"
+)
+
+func TestTerminal(t *testing.T) {
+	c := clock.New(27)
+	for i := 0; i < 66; i++ {
+		c.Step()
+	}
+	var buf bytes.Buffer
+	Terminal(&buf, c, "paused")
+	out := buf.String()
+	if !strings.HasPrefix(out, CLEAR_SCREEN) {
+		t.Errorf("Expected output to start by clearing the screen")
+	}
+	for _, expected := range []string{
+		"2:06",
+		"27 balls, minute 66, 0 refreshes",
+		"Hour     23" + DIM + strings.Repeat("   .", 10) + RESET + "\n",
+		"FiveMin   2" + DIM + strings.Repeat("   .", 10) + RESET + "\n",
+		"Min      20" + DIM + strings.Repeat("   .", 3) + RESET + "\n",
+		// 24 balls in the queue, drawn over two lines
+		"Main     21   8   7   6  25  13  12  11  10   0  26  22  18   5   1  24\n",
+		"\n         19  14   9   4   3  17  16  15" + DIM + strings.Repeat("   .", 3) + RESET + "\n",
+		"\npaused\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected output to contain %q:\n%s", expected, out)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package render
+
+import (
+	"fmt"
+	"github.com/bgmerrell/goballclock/ball"
+	"github.com/bgmerrell/goballclock/clock"
+	"io"
+	"strings"
+)
+
+// Options for drawing a clock as SVG
+type SVGOptions struct {
+	// Colour balls by ID rather than drawing them all the same colour
+	Color bool
+	// The clock's balls in ID order, e.g., from Clock.Balls().  Balls with
+	// attributes are drawn with their label rather than their ID, and in
+	// their colour whether or not Color is set.
+	Balls []ball.Tracked[uint32]
+}
+
+const BALL_COLOR = "#c0c0c0"
+
+// Return a colour for a ball, spreading the IDs around the colour wheel
+func ballColor(id int, nBalls int) string {
+	return fmt.Sprintf("hsl(%d, 70%%, 65%%)", id*360/max(nBalls, 1))
+}
+
+// Draw the queue and rails of a clock state as an SVG document
+func SVG(w io.Writer, s clock.State, opts SVGOptions) error {
+	slots, labels, width, height := layout(s)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="white"/>`+"\n", width, height)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="20" font-weight="bold">%s</text>`+"\n",
+		MARGIN, MARGIN+20, s.TimeString())
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="14">%d balls</text>`+"\n",
+		MARGIN+LABEL_WIDTH, MARGIN+20, s.NBalls())
+	for _, l := range labels {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="14" dominant-baseline="middle">%s</text>`+"\n",
+			l.x, l.y, l.text)
+	}
+	r := SLOT_SIZE/2 - 2
+	for _, sl := range slots {
+		if sl.id == -1 {
+			fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="%d" fill="none" stroke="#d0d0d0" stroke-dasharray="2 2"/>`+"\n",
+				sl.x, sl.y, r)
+			continue
+		}
+		fill := BALL_COLOR
+		if opts.Color {
+			fill = ballColor(sl.id, s.NBalls())
+		}
+		text := fmt.Sprint(sl.id)
+		if sl.id < len(opts.Balls) {
+			tracked := opts.Balls[sl.id]
+			text = tracked.Label()
+			if tracked.Attrs != nil && tracked.Attrs.Colour != "" {
+				fill = tracked.Attrs.Colour
+			}
+		}
+		fmt.Fprintf(&b, `<g class="ball" id="ball-%d"><circle cx="%d" cy="%d" r="%d" fill="%s" stroke="#404040"/>`+
+			`<text x="%d" y="%d" font-size="12" text-anchor="middle" dominant-baseline="central">%s</text></g>`+"\n",
+			sl.id, sl.x, sl.y, r, escapeText(fill), sl.x, sl.y, escapeText(text))
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,86 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/bgmerrell/goballclock/ball"
+	"github.com/bgmerrell/goballclock/clock"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSVG(t *testing.T) {
+	c := clock.New(30)
+	for i := 0; i < 500; i++ {
+		c.Step()
+	}
+	var buf bytes.Buffer
+	if err := SVG(&buf, c.State(), SVGOptions{Color: true}); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	out := buf.String()
+
+	// The document should be well-formed XML
+	dec := xml.NewDecoder(strings.NewReader(out))
+	for {
+		_, err := dec.Token()
+		if err != nil {
+			if err != io.EOF {
+				t.Fatalf("Malformed SVG (%s):\n%s", err.Error(), out)
+			}
+			break
+		}
+	}
+
+	// 500 minutes is 8 hours and 20 minutes
+	if !strings.Contains(out, ">9:20</text>") {
+		t.Errorf("Expected the time 9:20 in:\n%s", out)
+	}
+	// Every ball is drawn exactly once, and every empty slot is drawn
+	if n := strings.Count(out, `class="ball"`); n != 30 {
+		t.Errorf("Unexpected number of balls (actual %d, expected %d)", n, 30)
+	}
+	s := c.State()
+	empty := clock.HOUR_RAIL_CAP - len(s.Hour) + clock.FIVE_MIN_RAIL_CAP - len(s.FiveMin) +
+		clock.ONE_MIN_RAIL_CAP - len(s.Min) + 30 - len(s.Main)
+	if n := strings.Count(out, "stroke-dasharray"); n != empty {
+		t.Errorf("Unexpected number of empty slots (actual %d, expected %d)", n, empty)
+	}
+	if !strings.Contains(out, "hsl(") {
+		t.Errorf("Expected balls to be coloured")
+	}
+
+	buf.Reset()
+	SVG(&buf, s, SVGOptions{})
+	if strings.Contains(buf.String(), "hsl(") {
+		t.Errorf("Expected balls not to be coloured")
+	}
+}
+
+func TestSVGBalls(t *testing.T) {
+	balls := make([]ball.Tracked[uint8], 30)
+	for i := range balls {
+		balls[i].Id = uint8(i)
+	}
+	balls[7] = balls[7].WithAttributes(ball.Attributes{Label: "<chipped>", Colour: "steelblue"})
+	c, err := clock.NewFromBalls(balls)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	var buf bytes.Buffer
+	if err := SVG(&buf, c.State(), SVGOptions{Balls: c.Balls()}); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	out := buf.String()
+	if !strings.Contains(out, `fill="steelblue"`) || !strings.Contains(out, ">&lt;chipped&gt;</text>") {
+		t.Errorf("Expected ball 7's label and colour in:\n%s", out)
+	}
+	// the other balls are drawn as usual
+	if n := strings.Count(out, "fill=\""+BALL_COLOR+"\""); n != 29 {
+		t.Errorf("Unexpected number of plain balls (actual %d, expected %d)", n, 29)
+	}
+	if !strings.Contains(out, ">8</text>") {
+		t.Errorf("Expected ball 8's ID in:\n%s", out)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/bgmerrell/goballclock/repl"
+	"os"
+)
+
+// Explore a clock interactively
+func runRepl(args []string) error {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	nBalls := fs.Uint64("balls", 0, "create a clock with this many balls to start with")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	s := repl.New(os.Stdout)
+	fmt.Println("Type help for a list of commands.")
+	if *nBalls != 0 {
+		if err := s.Exec(fmt.Sprintf("new %d", *nBalls)); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return err
+		}
+	}
+	return repl.Run(os.Stdin, os.Stdout, s)
+}
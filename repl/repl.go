@@ -0,0 +1,296 @@
+/*
+an interactive shell for exploring a ball clock
+
+A Session holds a clock, a history of its earlier states for undo, named
+snapshots and a log of rail tips.  Commands are read a line at a time; see
+HELP for the list.
+*/
+package repl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bgmerrell/goballclock/clock"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const PROMPT = "ballclock> "
+
+// How many states undo can go back
+const MAX_HISTORY = 100
+
+// How many rail tips the tip log keeps
+const MAX_TIP_LOG = 1000
+
+// Steps are bounded so a typo cannot hang the session
+const MAX_STEP = 10000000
+
+const HELP = `Commands:
+  new N            create a clock with N balls
+  step [M]         run the clock for M minutes (default 1)
+  show             show the queue and rails
+  time             show the displayed time
+  where ID         show where ball ID is
+  tip-log [N]      show the last N rail tips (default 10)
+  undo             go back to the state before the last step, restore or new
+  snapshot [NAME]  save the state as NAME, or list saved states
+  restore NAME     go back to the state saved as NAME
+  cycle            show when the balls return to their original order
+  help             show this help
+  quit             leave`
+
+// Returned by Exec for the quit command
+var ErrQuit = errors.New("quit")
+
+// A rail tip: the ball lifted at a minute tipped one or more rails
+type tip struct {
+	minute uint64
+	move   clock.Move
+}
+
+// A state of the session that undo can return to
+type entry struct {
+	clock *clock.Clock
+	tips  []tip
+}
+
+type Session struct {
+	out       io.Writer
+	clock     *clock.Clock
+	history   []entry
+	snapshots map[string]*clock.Clock
+	tips      []tip
+}
+
+// Create a session with no clock, printing to out
+func New(out io.Writer) *Session {
+	return &Session{out: out, snapshots: make(map[string]*clock.Clock)}
+}
+
+// Read commands from in until it is exhausted or quit is entered
+func Run(in io.Reader, out io.Writer, s *Session) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, PROMPT)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		if err := s.Exec(scanner.Text()); err == ErrQuit {
+			return nil
+		} else if err != nil {
+			fmt.Fprintln(out, "error:", err.Error())
+		}
+	}
+}
+
+// Remember the current state so that undo can return to it
+func (s *Session) pushHistory() {
+	s.history = append(s.history, entry{s.clock.Clone(), s.tips})
+	if len(s.history) > MAX_HISTORY {
+		s.history = s.history[1:]
+	}
+}
+
+// Run one command
+func (s *Session) Exec(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	cmd, args := fields[0], fields[1:]
+	switch cmd {
+	case "help", "?":
+		fmt.Fprintln(s.out, HELP)
+		return nil
+	case "quit", "exit":
+		return ErrQuit
+	case "new":
+		return s.new(args)
+	}
+
+	if s.clock == nil {
+		return errors.New("No clock; create one with new N")
+	}
+	switch cmd {
+	case "step":
+		return s.step(args)
+	case "show":
+		s.show()
+	case "time":
+		fmt.Fprintf(s.out, "%s (minute %d)\n", s.clock.TimeString(), s.clock.Minutes())
+	case "where":
+		return s.where(args)
+	case "tip-log":
+		return s.tipLog(args)
+	case "undo":
+		return s.undo()
+	case "snapshot":
+		s.snapshot(args)
+	case "restore":
+		return s.restore(args)
+	case "cycle":
+		s.cycle()
+	default:
+		return fmt.Errorf("Unknown command \"%s\"; try help", cmd)
+	}
+	return nil
+}
+
+// Parse a single optional numeric argument
+func parseCount(args []string, def uint64, max uint64) (uint64, error) {
+	if len(args) == 0 {
+		return def, nil
+	}
+	if len(args) > 1 {
+		return 0, errors.New("Too many arguments")
+	}
+	n, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse \"%s\" as a number", args[0])
+	}
+	if n > max {
+		return 0, fmt.Errorf("%d is too large, the limit is %d", n, max)
+	}
+	return n, nil
+}
+
+func (s *Session) new(args []string) error {
+	if len(args) != 1 {
+		return errors.New("Usage: new N")
+	}
+	nBalls, err := strconv.ParseUint(args[0], 10, 8)
+	if err != nil {
+		return fmt.Errorf("Failed to parse \"%s\" as uint8", args[0])
+	}
+	if err = clock.CheckBallCount(nBalls); err != nil {
+		return err
+	}
+	if s.clock != nil {
+		s.pushHistory()
+	}
+	s.clock = clock.New(uint8(nBalls))
+	s.tips = nil
+	s.show()
+	return nil
+}
+
+func (s *Session) step(args []string) error {
+	n, err := parseCount(args, 1, MAX_STEP)
+	if err != nil {
+		return err
+	}
+	s.pushHistory()
+	for i := uint64(0); i < n; i++ {
+		move := s.clock.Step()
+		if move.Tips > 0 {
+			s.tips = append(s.tips, tip{s.clock.Minutes(), move})
+		}
+	}
+	if len(s.tips) > MAX_TIP_LOG {
+		s.tips = s.tips[len(s.tips)-MAX_TIP_LOG:]
+	}
+	fmt.Fprintf(s.out, "%s (minute %d)\n", s.clock.TimeString(), s.clock.Minutes())
+	return nil
+}
+
+func (s *Session) show() {
+	st := s.clock.State()
+	fmt.Fprintf(s.out, "%s, minute %d, %d refreshes\n",
+		s.clock.TimeString(), s.clock.Minutes(), s.clock.Refreshes())
+	fmt.Fprintf(s.out, "Hour    %v\n", st.Hour)
+	fmt.Fprintf(s.out, "FiveMin %v\n", st.FiveMin)
+	fmt.Fprintf(s.out, "Min     %v\n", st.Min)
+	fmt.Fprintf(s.out, "Main    %v\n", st.Main)
+}
+
+func (s *Session) where(args []string) error {
+	if len(args) != 1 {
+		return errors.New("Usage: where ID")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("Failed to parse \"%s\" as a ball ID", args[0])
+	}
+	if pos, ok := s.clock.State().Find(id); ok {
+		fmt.Fprintf(s.out, "ball %d is in %s at position %d\n", id, pos.Holder, pos.Index)
+		return nil
+	}
+	return fmt.Errorf("No ball %d", id)
+}
+
+var railNames = []string{"Min", "FiveMin", "Hour"}
+
+func (s *Session) tipLog(args []string) error {
+	n, err := parseCount(args, 10, MAX_TIP_LOG)
+	if err != nil {
+		return err
+	}
+	if len(s.tips) == 0 {
+		fmt.Fprintln(s.out, "no rails have tipped")
+		return nil
+	}
+	for _, t := range s.tips[max(0, len(s.tips)-int(n)):] {
+		fmt.Fprintf(s.out, "minute %d: ball %d tipped %s\n",
+			t.minute, t.move.Ball, strings.Join(railNames[:t.move.Tips], ", "))
+	}
+	return nil
+}
+
+func (s *Session) undo() error {
+	if len(s.history) == 0 {
+		return errors.New("Nothing to undo")
+	}
+	e := s.history[len(s.history)-1]
+	s.history = s.history[:len(s.history)-1]
+	s.clock = e.clock
+	s.tips = e.tips
+	fmt.Fprintf(s.out, "%s (minute %d)\n", s.clock.TimeString(), s.clock.Minutes())
+	return nil
+}
+
+func (s *Session) snapshot(args []string) {
+	if len(args) == 0 {
+		names := make([]string, 0, len(s.snapshots))
+		for name := range s.snapshots {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			c := s.snapshots[name]
+			fmt.Fprintf(s.out, "%s: %s (minute %d)\n", name, c.TimeString(), c.Minutes())
+		}
+		return
+	}
+	s.snapshots[args[0]] = s.clock.Clone()
+	fmt.Fprintf(s.out, "saved %s\n", args[0])
+}
+
+func (s *Session) restore(args []string) error {
+	if len(args) != 1 {
+		return errors.New("Usage: restore NAME")
+	}
+	c, ok := s.snapshots[args[0]]
+	if !ok {
+		return fmt.Errorf("No snapshot \"%s\"", args[0])
+	}
+	s.pushHistory()
+	s.clock = c.Clone()
+	// the tip log no longer describes how the clock got here
+	s.tips = nil
+	fmt.Fprintf(s.out, "%s (minute %d)\n", s.clock.TimeString(), s.clock.Minutes())
+	return nil
+}
+
+// Run a copy of the clock until its balls are back in their original order
+func (s *Session) cycle() {
+	c := s.clock.Clone()
+	days, _ := c.DaysUntilCycle(context.Background(), nil)
+	fmt.Fprintf(s.out, "the balls return to their original order after %d days (minute %d), %d minutes from now\n",
+		days, c.Minutes(), c.Minutes()-s.clock.Minutes())
+}
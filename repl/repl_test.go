@@ -0,0 +1,67 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Run commands in a session and return everything printed
+func runCommands(t *testing.T, input string) string {
+	var out bytes.Buffer
+	if err := Run(strings.NewReader(input), &out, New(&out)); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return out.String()
+}
+
+func expectOutput(t *testing.T, out string, expected ...string) {
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("Expected output to contain %q:\n%s", e, out)
+		}
+	}
+}
+
+func TestStepAndUndo(t *testing.T) {
+	out := runCommands(t, "step\nnew 30\nstep 60\ntime\nstep 5\nundo\ntime\nundo\nundo\nundo\n")
+	expectOutput(t, out,
+		"error: No clock; create one with new N",
+		"1:00, minute 0, 0 refreshes\n",
+		"Main    [0 1 2 3",
+		"2:00 (minute 60)\n"+PROMPT+"2:00 (minute 60)\n",
+		"2:05 (minute 65)\n"+PROMPT+"2:00 (minute 60)\n",
+		"1:00 (minute 0)\n",
+		"error: Nothing to undo",
+	)
+}
+
+func TestWhereAndTipLog(t *testing.T) {
+	out := runCommands(t, "new 30\nstep 6\nwhere 4\nwhere 5\nwhere 99\ntip-log\nstep 54\ntip-log 2\nundo\ntip-log 1\n")
+	expectOutput(t, out,
+		"ball 4 is in FiveMin at position 0\n",
+		"ball 5 is in Min at position 0\n",
+		"error: No ball 99",
+		"minute 5: ball 4 tipped Min\n",
+		"minute 55: ball 0 tipped Min\nminute 60: ball 5 tipped Min, FiveMin\n",
+	)
+	if !strings.HasSuffix(out, "minute 5: ball 4 tipped Min\n"+PROMPT+"\n") {
+		t.Errorf("Expected undo to truncate the tip log:\n%s", out)
+	}
+}
+
+func TestSnapshotAndCycle(t *testing.T) {
+	out := runCommands(t, "new 30\nstep 100\nsnapshot a\nstep 100\nsnapshot\nrestore a\ntime\nrestore b\ncycle\nbogus\nquit\nstep\n")
+	expectOutput(t, out,
+		"saved a\n",
+		"a: 2:40 (minute 100)\n",
+		"2:40 (minute 100)\n"+PROMPT+"2:40 (minute 100)\n",
+		"error: No snapshot \"b\"",
+		"after 15 days (minute 21600), 21500 minutes from now",
+		"error: Unknown command \"bogus\"",
+	)
+	// quit ends the session before the last step
+	if strings.Count(out, PROMPT) != 11 {
+		t.Errorf("Expected the session to end at quit:\n%s", out)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/bgmerrell/goballclock/clock"
+	"github.com/bgmerrell/goballclock/report"
+	"os"
+)
+
+// Write a self-contained HTML report on a range of ball counts
+func writeReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	from := fs.Uint64("from", clock.MIN_BALLS, "smallest ball count")
+	to := fs.Uint64("to", clock.MAX_BALLS, "largest ball count")
+	out := fs.String("o", "", "file to write the report to (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkBallRange(*from, *to); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return err
+	}
+
+	r, err := report.Build(context.Background(), uint8(*from), uint8(*to))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error computing cycles:", err.Error())
+		return err
+	}
+	file := os.Stdout
+	if *out != "" {
+		if file, err = os.Create(*out); err != nil {
+			fmt.Fprintln(os.Stderr, "Error creating report:", err.Error())
+			return err
+		}
+		defer file.Close()
+	}
+	if err = r.Write(file); err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing report:", err.Error())
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+/*
+self-contained HTML reports
+
+A report covers a range of ball counts: days until cycle for each, how the
+12-hour permutation of the queue decomposes into cycles, how much each rail
+is used before the clock cycles, and charts of the lot.  Everything,
+including the charts, is inlined into a single HTML file.
+*/
+package report
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"github.com/bgmerrell/goballclock/clock"
+	"github.com/bgmerrell/goballclock/render"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+//go:embed templates/*.html
+var templates embed.FS
+
+var reportTemplate = template.Must(template.ParseFS(templates, "templates/report.html"))
+
+// One ball count's line of the report
+type Row struct {
+	clock.Cycle
+	// Lengths of the cycles of the 12-hour permutation, e.g. "12×1, 5×3"
+	// for one cycle of length 12 and three of length 5
+	Decomposition string
+	// Average number of times each ball is lifted from the queue before
+	// the clock cycles
+	LiftsPerBall uint64
+}
+
+type Report struct {
+	From      uint8
+	To        uint8
+	Generated time.Time
+	Rows      []Row
+	// SVG charts of days until cycle, linear and log scale
+	Chart    template.HTML
+	LogChart template.HTML
+	// Days until cycle as a line of text
+	Sparkline string
+	// The ball count which takes longest to cycle
+	Longest clock.Cycle
+}
+
+// Describe cycle lengths (longest first) as length×count pairs
+func describeLengths(lengths []int) string {
+	var parts []string
+	for i := 0; i < len(lengths); {
+		j := i
+		for j < len(lengths) && lengths[j] == lengths[i] {
+			j++
+		}
+		parts = append(parts, fmt.Sprintf("%d×%d", lengths[i], j-i))
+		i = j
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Draw a chart into a string for inlining
+func chartHTML(table []clock.Cycle, opts render.ChartOptions) template.HTML {
+	var b strings.Builder
+	render.Chart(&b, table, opts)
+	return template.HTML(b.String())
+}
+
+// Compute a report on the ball counts from from to to (inclusive)
+func Build(ctx context.Context, from uint8, to uint8) (*Report, error) {
+	table, err := clock.CycleTable(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{
+		From:      from,
+		To:        to,
+		Generated: time.Now(),
+		Chart:     chartHTML(table, render.ChartOptions{Title: "Days until cycle"}),
+		LogChart:  chartHTML(table, render.ChartOptions{Title: "Days until cycle (log scale)", Log: true}),
+		Sparkline: render.Sparkline(table, true),
+	}
+	for _, c := range table {
+		r.Rows = append(r.Rows, Row{
+			Cycle:         c,
+			Decomposition: describeLengths(clock.CycleLengths(clock.HalfDayPermutation(c.Balls))),
+			LiftsPerBall:  c.Stats.Minutes / uint64(c.Balls),
+		})
+		if c.Days > r.Longest.Days {
+			r.Longest = c
+		}
+	}
+	return r, nil
+}
+
+// Write a report as a single HTML file
+func (r *Report) Write(w io.Writer) error {
+	return reportTemplate.Execute(w, r)
+}
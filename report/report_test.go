@@ -0,0 +1,47 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDescribeLengths(t *testing.T) {
+	actual := describeLengths([]int{12, 5, 5, 5, 1})
+	expected := "12×1, 5×3, 1×1"
+	if actual != expected {
+		t.Errorf("Unexpected description (actual %s, expected %s)", actual, expected)
+	}
+}
+
+func TestReport(t *testing.T) {
+	r, err := Build(context.Background(), 30, 33)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(r.Rows) != 4 || r.Longest.Balls != 33 || r.Longest.Days != 138 {
+		t.Errorf("Unexpected report: %+v", r)
+	}
+	if r.Rows[0].LiftsPerBall != 720 {
+		t.Errorf("Unexpected lifts per ball (actual %d, expected %d)", r.Rows[0].LiftsPerBall, 720)
+	}
+
+	var buf bytes.Buffer
+	if err = r.Write(&buf); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		"<title>Ball clock report: 30–33 balls</title>",
+		"33 balls take longest, cycling after 138 days",
+		"<tr><td>30</td><td>15</td><td>30</td>",
+		"<tr><td>30</td><td>21600</td><td>4320</td><td>360</td><td>30</td><td>720</td></tr>",
+		// the charts are inlined, not escaped
+		"<svg xmlns=",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected report to contain %q:\n%s", expected, out)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/bgmerrell/goballclock/jobs"
+	"github.com/bgmerrell/goballclock/server"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const DEFAULT_ADDR = "localhost:8080"
+const DEFAULT_SHUTDOWN_TIMEOUT = 10 * time.Second
+
+// Serve the HTTP JSON API until interrupted, then shut down gracefully,
+// letting in-flight requests finish.
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", DEFAULT_ADDR, "address to listen on")
+	timeout := fs.Duration("shutdown-timeout", DEFAULT_SHUTDOWN_TIMEOUT,
+		"how long to wait for in-flight requests on shutdown")
+	jobConcurrency := fs.Int("job-concurrency", server.DEFAULT_JOB_CONCURRENCY,
+		"how many background computations may run at once")
+	jobRetention := fs.Duration("job-retention", server.DEFAULT_JOB_RETENTION,
+		"how long finished background computations are kept")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	handler := server.NewWithJobs(jobs.NewManager(*jobConcurrency, *jobRetention))
+	srv := &http.Server{Addr: *addr, Handler: handler}
+	srv.RegisterOnShutdown(handler.Close)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		fmt.Fprintln(os.Stderr, "Serving on", *addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		fmt.Fprintln(os.Stderr, "Error serving:", err.Error())
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintln(os.Stderr, "Error shutting down:", err.Error())
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
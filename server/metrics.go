@@ -0,0 +1,48 @@
+package server
+
+import (
+	"github.com/bgmerrell/goballclock/clock"
+	"github.com/bgmerrell/goballclock/metrics"
+)
+
+// What the server exposes at /metrics
+type serverMetrics struct {
+	registry         *metrics.Registry
+	clocksComputed   *metrics.Counter
+	minutesSimulated *metrics.Counter
+	railTips         *metrics.CounterVec
+	cacheHits        *metrics.Counter
+	cacheMisses      *metrics.Counter
+	inputErrors      *metrics.CounterVec
+	computeSeconds   *metrics.HistogramVec
+}
+
+func newServerMetrics() *serverMetrics {
+	r := metrics.NewRegistry()
+	return &serverMetrics{
+		registry: r,
+		clocksComputed: r.NewCounter("ballclock_clocks_computed_total",
+			"Number of clocks run until their balls cycled."),
+		minutesSimulated: r.NewCounter("ballclock_minutes_simulated_total",
+			"Number of clock minutes simulated."),
+		railTips: r.NewCounterVec("ballclock_rail_tips_total",
+			"Number of times a rail tipped, by rail.", "rail"),
+		cacheHits: r.NewCounter("ballclock_cycle_cache_hits_total",
+			"Number of days-until-cycle answers served from the cache."),
+		cacheMisses: r.NewCounter("ballclock_cycle_cache_misses_total",
+			"Number of days-until-cycle answers which had to be computed."),
+		inputErrors: r.NewCounterVec("ballclock_input_errors_total",
+			"Number of rejected requests, by class of input error.", "class"),
+		computeSeconds: r.NewHistogramVec("ballclock_cycle_computation_seconds",
+			"Time taken to compute days until cycle, by ball count.", "balls",
+			metrics.DEFAULT_BUCKETS),
+	}
+}
+
+// Count the minutes and rail tips of a clock that has finished running
+func (m *serverMetrics) observeClock(stats clock.Stats) {
+	m.minutesSimulated.Add(stats.Minutes)
+	m.railTips.With("one_min").Add(stats.OneMinTips)
+	m.railTips.With("five_min").Add(stats.FiveMinTips)
+	m.railTips.With("hour").Add(stats.HourTips)
+}
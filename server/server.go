@@ -0,0 +1,307 @@
+/*
+an HTTP JSON API for the ball clock
+
+Endpoints:
+
+	GET  /cycle?balls=N   days until N balls cycle
+	POST /simulate        state of a clock after running for some minutes
+	POST /batch           days until cycle for several ball counts
+	GET  /stream?balls=N  Server-Sent Events of a running clock's state
+	POST /stream/ID/CMD   control a stream: pause, resume or seek
+	POST /jobs            start computing days until cycle in the background
+	GET  /jobs/ID         poll a background computation
+	DELETE /jobs/ID       cancel a background computation
+	GET  /metrics         metrics in the Prometheus text exposition format
+
+Errors are reported as a JSON object with an "error" member.
+*/
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/bgmerrell/goballclock/clock"
+	"github.com/bgmerrell/goballclock/jobs"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits on how much work a single request may ask for
+const MAX_SIMULATE_MINUTES = 10000000
+const MAX_BATCH_SIZE = 128
+const MAX_BODY_BYTES = 1 << 20
+
+// Defaults for the background job Manager created by New
+const DEFAULT_JOB_RETENTION = time.Hour
+
+var DEFAULT_JOB_CONCURRENCY = runtime.NumCPU()
+
+// The ball clock API, an http.Handler
+type Server struct {
+	mux *http.ServeMux
+	// live streams, by ID
+	streams   map[string]*stream
+	streamsMu sync.Mutex
+	jobs      *jobs.Manager
+	metrics   *serverMetrics
+	// days until cycle, by ball count
+	cycleCache   map[uint8]uint64
+	cycleCacheMu sync.Mutex
+}
+
+type cycleResponse struct {
+	Balls uint64 `json:"balls"`
+	Days  uint64 `json:"days"`
+}
+
+type simulateRequest struct {
+	Balls   uint64 `json:"balls"`
+	Minutes uint64 `json:"minutes"`
+}
+
+type simulateResponse struct {
+	Balls   uint64      `json:"balls"`
+	Minutes uint64      `json:"minutes"`
+	Time    string      `json:"time"`
+	State   clock.State `json:"state"`
+}
+
+type batchRequest struct {
+	Balls []uint64 `json:"balls"`
+}
+
+type batchResponse struct {
+	Results []cycleResponse `json:"results"`
+}
+
+type jobRequest struct {
+	Balls uint64 `json:"balls"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Create a new Server with all endpoints registered
+func New() *Server {
+	return NewWithJobs(jobs.NewManager(DEFAULT_JOB_CONCURRENCY, DEFAULT_JOB_RETENTION))
+}
+
+// Create a new Server which runs background computations with m
+func NewWithJobs(m *jobs.Manager) *Server {
+	s := &Server{
+		mux:        http.NewServeMux(),
+		streams:    make(map[string]*stream),
+		jobs:       m,
+		metrics:    newServerMetrics(),
+		cycleCache: make(map[uint8]uint64),
+	}
+	s.mux.HandleFunc("/cycle", allow("GET", s.handleCycle))
+	s.mux.HandleFunc("/simulate", allow("POST", s.handleSimulate))
+	s.mux.HandleFunc("/batch", allow("POST", s.handleBatch))
+	s.mux.HandleFunc("/stream", allow("GET", s.handleStream))
+	s.mux.HandleFunc("/stream/", allow("POST", s.handleStreamControl))
+	s.mux.HandleFunc("/jobs", allow("POST", s.handleSubmitJob))
+	s.mux.HandleFunc("/jobs/", s.handleJob)
+	s.mux.Handle("/metrics", s.metrics.registry)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Wrap a handler so that it only answers requests using method
+func allow(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed,
+				fmt.Sprintf("Method %s not allowed", r.Method))
+			return
+		}
+		h(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{msg})
+}
+
+// Count a bad request by class and write an error response for it
+func (s *Server) inputError(w http.ResponseWriter, class string, msg string) {
+	s.metrics.inputErrors.With(class).Inc()
+	writeError(w, http.StatusBadRequest, msg)
+}
+
+// Decode a JSON request body into v, writing an error response on failure
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_BODY_BYTES))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		s.inputError(w, "body", fmt.Sprintf("Malformed request body (%s)", err.Error()))
+		return false
+	}
+	return true
+}
+
+// Validate a ball count, writing an error response if it is out of range
+func (s *Server) checkBalls(w http.ResponseWriter, nBalls uint64) bool {
+	if err := clock.CheckBallCount(nBalls); err != nil {
+		s.inputError(w, "range", fmt.Sprintf("Malformed input (%s)", err.Error()))
+		return false
+	}
+	return true
+}
+
+// Parse and validate the "balls" query parameter, writing an error response
+// on failure
+func (s *Server) queryBalls(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	text := r.URL.Query().Get("balls")
+	nBalls, err := strconv.ParseUint(text, 10, 8)
+	if err != nil {
+		s.inputError(w, "parse",
+			fmt.Sprintf("Malformed input (failed to parse \"%s\" as uint8)", text))
+		return 0, false
+	}
+	return nBalls, s.checkBalls(w, nBalls)
+}
+
+func (s *Server) handleCycle(w http.ResponseWriter, r *http.Request) {
+	nBalls, ok := s.queryBalls(w, r)
+	if !ok {
+		return
+	}
+	days, err := s.cycleDays(r.Context(), uint8(nBalls), nil)
+	if err != nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, cycleResponse{nBalls, days})
+}
+
+func (s *Server) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	var req simulateRequest
+	if !s.decodeBody(w, r, &req) || !s.checkBalls(w, req.Balls) {
+		return
+	}
+	if req.Minutes > MAX_SIMULATE_MINUTES {
+		s.inputError(w, "limit",
+			fmt.Sprintf("Malformed input (Too many minutes, %d > %d)",
+				req.Minutes, MAX_SIMULATE_MINUTES))
+		return
+	}
+	c := clock.New(uint8(req.Balls))
+	for i := uint64(0); i < req.Minutes; i++ {
+		c.Step()
+	}
+	s.metrics.observeClock(c.Stats())
+	writeJSON(w, http.StatusOK,
+		simulateResponse{req.Balls, c.Minutes(), c.TimeString(), c.State()})
+}
+
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if len(req.Balls) > MAX_BATCH_SIZE {
+		s.inputError(w, "limit",
+			fmt.Sprintf("Malformed input (Too many ball counts, %d > %d)",
+				len(req.Balls), MAX_BATCH_SIZE))
+		return
+	}
+	for _, nBalls := range req.Balls {
+		if !s.checkBalls(w, nBalls) {
+			return
+		}
+	}
+	resp := batchResponse{make([]cycleResponse, len(req.Balls))}
+	for i, nBalls := range req.Balls {
+		days, err := s.cycleDays(r.Context(), uint8(nBalls), nil)
+		if err != nil {
+			return
+		}
+		resp.Results[i] = cycleResponse{nBalls, days}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Return the days until nBalls balls cycle, from the cache if possible.  An
+// error is only returned if ctx is done before the computation finishes.
+func (s *Server) cycleDays(ctx context.Context, nBalls uint8,
+	progress func(minutes uint64, refreshes uint64)) (uint64, error) {
+	s.cycleCacheMu.Lock()
+	days, ok := s.cycleCache[nBalls]
+	s.cycleCacheMu.Unlock()
+	if ok {
+		s.metrics.cacheHits.Inc()
+		return days, nil
+	}
+	s.metrics.cacheMisses.Inc()
+
+	start := time.Now()
+	c := clock.New(nBalls)
+	days, err := c.DaysUntilCycle(ctx, progress)
+	s.metrics.observeClock(c.Stats())
+	if err != nil {
+		return 0, err
+	}
+	s.metrics.clocksComputed.Inc()
+	s.metrics.computeSeconds.With(strconv.Itoa(int(nBalls))).Observe(time.Since(start).Seconds())
+
+	s.cycleCacheMu.Lock()
+	s.cycleCache[nBalls] = days
+	s.cycleCacheMu.Unlock()
+	return days, nil
+}
+
+func (s *Server) handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+	if !s.decodeBody(w, r, &req) || !s.checkBalls(w, req.Balls) {
+		return
+	}
+	nBalls := uint8(req.Balls)
+	id := s.jobs.Submit(func(ctx context.Context, progress func(jobs.Progress)) (interface{}, error) {
+		days, err := s.cycleDays(ctx, nBalls, func(minutes uint64, refreshes uint64) {
+			progress(jobs.Progress{Minutes: minutes, Refreshes: refreshes})
+		})
+		if err != nil {
+			return nil, err
+		}
+		return jobs.CycleResult{Balls: nBalls, Days: days}, nil
+	})
+	j, _ := s.jobs.Get(id)
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+// Poll (GET) or cancel (DELETE) a background computation
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	switch r.Method {
+	case "GET":
+	case "DELETE":
+		s.jobs.Cancel(id)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeError(w, http.StatusMethodNotAllowed,
+			fmt.Sprintf("Method %s not allowed", r.Method))
+		return
+	}
+	j, ok := s.jobs.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such job")
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
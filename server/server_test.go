@@ -0,0 +1,202 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bgmerrell/goballclock/jobs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Make a request against a new Server and decode the JSON response into v.
+// The response status code is returned.
+func doRequest(t *testing.T, method string, target string, body string, v interface{}) int {
+	return doServerRequest(t, New(), method, target, body, v)
+}
+
+// Like doRequest, but against the Server s
+func doServerRequest(t *testing.T, s *Server, method string, target string, body string, v interface{}) int {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Unexpected content type (actual %s, expected %s)", ct, "application/json")
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("Failed to decode response (%s): %s", rec.Body.String(), err.Error())
+	}
+	return rec.Code
+}
+
+func TestCycle(t *testing.T) {
+	var resp cycleResponse
+	code := doRequest(t, "GET", "/cycle?balls=45", "", &resp)
+	if code != http.StatusOK {
+		t.Fatalf("Unexpected status (actual %d, expected %d)", code, http.StatusOK)
+	}
+	if resp.Balls != 45 || resp.Days != 378 {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+}
+
+func TestCycleErrors(t *testing.T) {
+	for target, expected := range map[string]string{
+		"/cycle?balls=26":  "Malformed input (Too few balls, 26 < 27)",
+		"/cycle?balls=128": "Malformed input (Too many balls, 128 > 127)",
+		"/cycle?balls=256": "Malformed input (failed to parse \"256\" as uint8)",
+		"/cycle":           "Malformed input (failed to parse \"\" as uint8)",
+	} {
+		var resp errorResponse
+		code := doRequest(t, "GET", target, "", &resp)
+		if code != http.StatusBadRequest {
+			t.Errorf("Unexpected status for %s (actual %d, expected %d)",
+				target, code, http.StatusBadRequest)
+		}
+		if resp.Error != expected {
+			t.Errorf("Unexpected error for %s:\n"+
+				"Actual: %s\n"+
+				"Expected: %s",
+				target,
+				resp.Error,
+				expected)
+		}
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	var resp errorResponse
+	code := doRequest(t, "GET", "/simulate", "", &resp)
+	if code != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status (actual %d, expected %d)", code, http.StatusMethodNotAllowed)
+	}
+	if resp.Error == "" {
+		t.Errorf("Expected an error message")
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	var resp simulateResponse
+	code := doRequest(t, "POST", "/simulate", `{"balls": 30, "minutes": 5}`, &resp)
+	if code != http.StatusOK {
+		t.Fatalf("Unexpected status (actual %d, expected %d)", code, http.StatusOK)
+	}
+	if resp.Time != "1:05" {
+		t.Errorf("Unexpected time (actual %s, expected %s)", resp.Time, "1:05")
+	}
+	expected := "{[] [4] [] [5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20 21 22 23 24 25 26 27 28 29 3 2 1 0]}"
+	if fmt.Sprintf("%v", resp.State) != expected {
+		t.Errorf("Unexpected state:\n"+
+			"Actual: %v\n"+
+			"Expected: %s",
+			resp.State,
+			expected)
+	}
+}
+
+func TestSimulateErrors(t *testing.T) {
+	for body, expected := range map[string]string{
+		`{"balls": 20, "minutes": 5}`:        "Malformed input (Too few balls, 20 < 27)",
+		`{"balls": 30, "minutes": 20000000}`: "Malformed input (Too many minutes, 20000000 > 10000000)",
+		`{"balls": 30, "hours": 5}`:          "Malformed request body (json: unknown field \"hours\")",
+	} {
+		var resp errorResponse
+		code := doRequest(t, "POST", "/simulate", body, &resp)
+		if code != http.StatusBadRequest {
+			t.Errorf("Unexpected status for %s (actual %d, expected %d)",
+				body, code, http.StatusBadRequest)
+		}
+		if resp.Error != expected {
+			t.Errorf("Unexpected error for %s:\n"+
+				"Actual: %s\n"+
+				"Expected: %s",
+				body,
+				resp.Error,
+				expected)
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var resp batchResponse
+	code := doRequest(t, "POST", "/batch", `{"balls": [30, 45]}`, &resp)
+	if code != http.StatusOK {
+		t.Fatalf("Unexpected status (actual %d, expected %d)", code, http.StatusOK)
+	}
+	expected := "[{30 15} {45 378}]"
+	if fmt.Sprintf("%v", resp.Results) != expected {
+		t.Errorf("Unexpected results (actual %v, expected %s)", resp.Results, expected)
+	}
+
+	var errResp errorResponse
+	code = doRequest(t, "POST", "/batch", `{"balls": [30, 128]}`, &errResp)
+	if code != http.StatusBadRequest {
+		t.Errorf("Unexpected status (actual %d, expected %d)", code, http.StatusBadRequest)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	s := New()
+	var j jobs.Job
+	code := doServerRequest(t, s, "POST", "/jobs", `{"balls": 45}`, &j)
+	if code != http.StatusAccepted {
+		t.Fatalf("Unexpected status (actual %d, expected %d)", code, http.StatusAccepted)
+	}
+	id := j.Id
+	for deadline := time.Now().Add(10 * time.Second); j.Status != jobs.DONE; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for job: %+v", j)
+		}
+		time.Sleep(time.Millisecond)
+		code = doServerRequest(t, s, "GET", "/jobs/"+id, "", &j)
+		if code != http.StatusOK {
+			t.Fatalf("Unexpected status (actual %d, expected %d)", code, http.StatusOK)
+		}
+	}
+	expected := "map[balls:45 days:378]"
+	if fmt.Sprintf("%v", j.Result) != expected {
+		t.Errorf("Unexpected result (actual %v, expected %s)", j.Result, expected)
+	}
+
+	var resp errorResponse
+	code = doServerRequest(t, s, "DELETE", "/jobs/nosuchjob", "", &resp)
+	if code != http.StatusNotFound {
+		t.Errorf("Unexpected status (actual %d, expected %d)", code, http.StatusNotFound)
+	}
+	code = doServerRequest(t, s, "POST", "/jobs", `{"balls": 200}`, &resp)
+	if code != http.StatusBadRequest {
+		t.Errorf("Unexpected status (actual %d, expected %d)", code, http.StatusBadRequest)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s := New()
+	var resp cycleResponse
+	doServerRequest(t, s, "GET", "/cycle?balls=30", "", &resp)
+	doServerRequest(t, s, "GET", "/cycle?balls=30", "", &resp)
+	var errResp errorResponse
+	doServerRequest(t, s, "GET", "/cycle?balls=x", "", &errResp)
+	doServerRequest(t, s, "GET", "/cycle?balls=20", "", &errResp)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	// 30 balls cycle after 30 refreshes
+	for _, expected := range []string{
+		"ballclock_clocks_computed_total 1\n",
+		"ballclock_minutes_simulated_total 21600\n",
+		"ballclock_rail_tips_total{rail=\"hour\"} 30\n",
+		"ballclock_rail_tips_total{rail=\"one_min\"} 4320\n",
+		"ballclock_cycle_cache_hits_total 1\n",
+		"ballclock_cycle_cache_misses_total 1\n",
+		"ballclock_input_errors_total{class=\"parse\"} 1\n",
+		"ballclock_input_errors_total{class=\"range\"} 1\n",
+		"ballclock_cycle_computation_seconds_count{balls=\"30\"} 1\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics to contain %q:\n%s", expected, body)
+		}
+	}
+}
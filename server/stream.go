@@ -0,0 +1,224 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/bgmerrell/goballclock/clock"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stream speeds, in clock minutes per second
+const DEFAULT_STREAM_SPEED = 60.0
+const MIN_STREAM_SPEED = 0.01
+const MAX_STREAM_SPEED = 1000.0
+
+// A running clock whose state is pushed to a client as Server-Sent Events
+type stream struct {
+	// commands from the control endpoint
+	controls chan control
+	// closed when the stream ends
+	done chan struct{}
+	// closed to ask the stream to end
+	quit chan struct{}
+}
+
+// A command for a stream.  The stream answers on reply with the event it
+// sent after applying the command.
+type control struct {
+	cmd     string
+	minutes uint64
+	reply   chan streamEvent
+}
+
+type streamEvent struct {
+	Id      string      `json:"id"`
+	Balls   uint64      `json:"balls"`
+	Minutes uint64      `json:"minutes"`
+	Time    string      `json:"time"`
+	Paused  bool        `json:"paused"`
+	State   clock.State `json:"state"`
+}
+
+type seekRequest struct {
+	Minutes uint64 `json:"minutes"`
+}
+
+func newStreamId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// End all live streams.  Long-lived stream requests would otherwise hold up
+// a graceful shutdown; see http.Server.RegisterOnShutdown.
+func (s *Server) Close() {
+	s.streamsMu.Lock()
+	defer s.streamsMu.Unlock()
+	for id, st := range s.streams {
+		close(st.quit)
+		delete(s.streams, id)
+	}
+}
+
+func (s *Server) addStream(id string, st *stream) {
+	s.streamsMu.Lock()
+	defer s.streamsMu.Unlock()
+	s.streams[id] = st
+}
+
+func (s *Server) getStream(id string) *stream {
+	s.streamsMu.Lock()
+	defer s.streamsMu.Unlock()
+	return s.streams[id]
+}
+
+func (s *Server) removeStream(id string) {
+	s.streamsMu.Lock()
+	defer s.streamsMu.Unlock()
+	delete(s.streams, id)
+}
+
+// Step a clock at the requested speed, sending its state after every change.
+// The first event carries the ID used to control the stream.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	nBalls, ok := s.queryBalls(w, r)
+	if !ok {
+		return
+	}
+	speed := DEFAULT_STREAM_SPEED
+	if text := r.URL.Query().Get("speed"); text != "" {
+		var err error
+		if speed, err = strconv.ParseFloat(text, 64); err != nil {
+			s.inputError(w, "parse",
+				fmt.Sprintf("Malformed input (failed to parse \"%s\" as a speed)", text))
+			return
+		}
+		if math.IsNaN(speed) || speed < MIN_STREAM_SPEED || speed > MAX_STREAM_SPEED {
+			s.inputError(w, "limit",
+				fmt.Sprintf("Malformed input (speed must be in [%g, %g], got %g)",
+					MIN_STREAM_SPEED, MAX_STREAM_SPEED, speed))
+			return
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Streaming unsupported")
+		return
+	}
+
+	id := newStreamId()
+	st := &stream{make(chan control), make(chan struct{}), make(chan struct{})}
+	s.addStream(id, st)
+	defer s.removeStream(id)
+	defer close(st.done)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	c := clock.New(uint8(nBalls))
+	defer func() { s.metrics.observeClock(c.Stats()) }()
+	paused := false
+	send := func() (streamEvent, error) {
+		ev := streamEvent{id, nBalls, c.Minutes(), c.TimeString(), paused, c.State()}
+		data, _ := json.Marshal(ev)
+		_, err := fmt.Fprintf(w, "event: state\ndata: %s\n\n", data)
+		flusher.Flush()
+		return ev, err
+	}
+	if _, err := send(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / speed))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-st.quit:
+			return
+		case <-ticker.C:
+			if paused {
+				continue
+			}
+			c.Step()
+			if _, err := send(); err != nil {
+				return
+			}
+		case ctl := <-st.controls:
+			switch ctl.cmd {
+			case "pause":
+				paused = true
+			case "resume":
+				paused = false
+			case "seek":
+				if ctl.minutes < c.Minutes() {
+					s.metrics.observeClock(c.Stats())
+					c = clock.New(uint8(nBalls))
+				}
+				for c.Minutes() < ctl.minutes {
+					c.Step()
+				}
+			}
+			ev, err := send()
+			ctl.reply <- ev
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Pass a pause, resume or seek command to a live stream and answer with the
+// stream's resulting state
+func (s *Server) handleStreamControl(w http.ResponseWriter, r *http.Request) {
+	// /stream/ID/CMD
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/stream/"), "/")
+	if len(parts) != 2 {
+		writeError(w, http.StatusNotFound, "No such stream")
+		return
+	}
+	id := parts[0]
+	ctl := control{cmd: parts[1], reply: make(chan streamEvent, 1)}
+	switch ctl.cmd {
+	case "pause", "resume":
+	case "seek":
+		var req seekRequest
+		if !s.decodeBody(w, r, &req) {
+			return
+		}
+		if req.Minutes > MAX_SIMULATE_MINUTES {
+			s.inputError(w, "limit",
+				fmt.Sprintf("Malformed input (Too many minutes, %d > %d)",
+					req.Minutes, MAX_SIMULATE_MINUTES))
+			return
+		}
+		ctl.minutes = req.Minutes
+	default:
+		writeError(w, http.StatusNotFound,
+			fmt.Sprintf("Unknown stream command \"%s\"", ctl.cmd))
+		return
+	}
+
+	st := s.getStream(id)
+	if st == nil {
+		writeError(w, http.StatusNotFound, "No such stream")
+		return
+	}
+	select {
+	case st.controls <- ctl:
+	case <-st.done:
+		writeError(w, http.StatusNotFound, "No such stream")
+		return
+	case <-r.Context().Done():
+		return
+	}
+	writeJSON(w, http.StatusOK, <-ctl.reply)
+}
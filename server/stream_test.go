@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Read Server-Sent Events until one satisfies match
+func readEvent(t *testing.T, scanner *bufio.Scanner, match func(ev streamEvent) bool) streamEvent {
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var ev streamEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev); err != nil {
+			t.Fatalf("Failed to decode event (%s): %s", line, err.Error())
+		}
+		if match(ev) {
+			return ev
+		}
+	}
+	t.Fatalf("Stream ended unexpectedly: %v", scanner.Err())
+	return streamEvent{}
+}
+
+// Send a command to a stream and decode the resulting event
+func sendControl(t *testing.T, ts *httptest.Server, id string, cmd string, body string) streamEvent {
+	resp, err := http.Post(ts.URL+"/stream/"+id+"/"+cmd, "application/json",
+		strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to send %s: %s", cmd, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected status for %s (actual %d, expected %d)",
+			cmd, resp.StatusCode, http.StatusOK)
+	}
+	var ev streamEvent
+	if err := json.NewDecoder(resp.Body).Decode(&ev); err != nil {
+		t.Fatalf("Failed to decode %s response: %s", cmd, err.Error())
+	}
+	return ev
+}
+
+func TestStream(t *testing.T) {
+	s := New()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	defer s.Close()
+
+	resp, err := http.Get(ts.URL + "/stream?balls=30&speed=1000")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Unexpected content type (actual %s, expected %s)", ct, "text/event-stream")
+	}
+	scanner := bufio.NewScanner(resp.Body)
+
+	first := readEvent(t, scanner, func(ev streamEvent) bool { return true })
+	if first.Minutes != 0 || first.Time != "1:00" || len(first.State.Main) != 30 {
+		t.Errorf("Unexpected first event: %+v", first)
+	}
+	// The clock should be stepping
+	readEvent(t, scanner, func(ev streamEvent) bool { return ev.Minutes == 5 })
+
+	ev := sendControl(t, ts, first.Id, "pause", "")
+	if !ev.Paused {
+		t.Errorf("Expected stream to be paused")
+	}
+	ev = sendControl(t, ts, first.Id, "seek", `{"minutes": 61}`)
+	if ev.Minutes != 61 || ev.Time != "2:01" || !ev.Paused {
+		t.Errorf("Unexpected event after seek: %+v", ev)
+	}
+	ev = sendControl(t, ts, first.Id, "seek", `{"minutes": 1}`)
+	if ev.Minutes != 1 || ev.Time != "1:01" {
+		t.Errorf("Unexpected event after seeking backwards: %+v", ev)
+	}
+	ev = sendControl(t, ts, first.Id, "resume", "")
+	if ev.Paused {
+		t.Errorf("Expected stream to be resumed")
+	}
+	readEvent(t, scanner, func(ev streamEvent) bool { return ev.Minutes == 3 })
+}
+
+func TestStreamControlErrors(t *testing.T) {
+	var resp errorResponse
+	code := doRequest(t, "POST", "/stream/nosuchstream/pause", "", &resp)
+	if code != http.StatusNotFound {
+		t.Errorf("Unexpected status (actual %d, expected %d)", code, http.StatusNotFound)
+	}
+	code = doRequest(t, "POST", "/stream/nosuchstream/rewind", "", &resp)
+	if code != http.StatusNotFound || resp.Error != "Unknown stream command \"rewind\"" {
+		t.Errorf("Unexpected response (%d): %+v", code, resp)
+	}
+	for _, speed := range []string{"0", "1e-10", "NaN", "-Inf", "+Inf", "1001"} {
+		code = doRequest(t, "GET", "/stream?balls=30&speed="+speed, "", &resp)
+		if code != http.StatusBadRequest {
+			t.Errorf("Unexpected status for speed %s (actual %d, expected %d)",
+				speed, code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/bgmerrell/goballclock/clock"
+	"os"
+)
+
+// What set mode prints: everything needed to load the balls into a clock
+type setResult struct {
+	Time  string      `json:"time"`
+	Stats clock.Stats `json:"stats"`
+	State clock.State `json:"state"`
+}
+
+// Print the state a fresh clock would be in at a given time of day,
+// optionally some days later
+func setClock(args []string) error {
+	fs := flag.NewFlagSet("set", flag.ContinueOnError)
+	nBalls := fs.Uint64("balls", clock.MIN_BALLS, "number of balls in the clock")
+	days := fs.Uint64("days", 0, "whole days to run the clock before setting the time")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: set [options] HH:MM\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("Expected a time, got %d arguments", fs.NArg())
+	}
+	var hour, minute int
+	var extra string
+	if n, _ := fmt.Sscanf(fs.Arg(0), "%d:%d%s", &hour, &minute, &extra); n != 2 {
+		err := fmt.Errorf("Malformed input (failed to parse \"%s\" as HH:MM)", fs.Arg(0))
+		fmt.Fprintln(os.Stderr, err.Error())
+		return err
+	}
+	if err := clock.CheckBallCount(*nBalls); err != nil {
+		fmt.Fprintf(os.Stderr, "Malformed input (%s)\n", err.Error())
+		return err
+	}
+	c, err := clock.SetTime(uint8(*nBalls), *days, hour, minute)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Malformed input (%s)\n", err.Error())
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(setResult{c.TimeString(), c.Stats(), c.State()})
+}
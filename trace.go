@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/bgmerrell/goballclock/clock"
+	"os"
+	"os/signal"
+)
+
+// Follow one ball through a clock run, printing where it is as JSON lines
+func trace(args []string) error {
+	fs := flag.NewFlagSet("trace", flag.ContinueOnError)
+	nBalls := fs.Uint64("balls", clock.MIN_BALLS, "number of balls in the clock")
+	id := fs.Int("ball", 0, "ID of the ball to follow")
+	minutes := fs.Uint64("minutes", 1440, "minutes to run the clock (0 for no limit)")
+	transitions := fs.Bool("transitions", false, "only print when the ball changes holders")
+	untilReturn := fs.Bool("until-return", false, "stop when the ball returns to its starting queue position")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := clock.CheckBallCount(*nBalls); err != nil {
+		fmt.Fprintf(os.Stderr, "Malformed input (%s)\n", err.Error())
+		return err
+	}
+	if *id < 0 || *id >= int(*nBalls) {
+		err := fmt.Errorf("Malformed input (ball ID %d out of range [0, %d))", *id, *nBalls)
+		fmt.Fprintln(os.Stderr, err.Error())
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	enc := json.NewEncoder(out)
+	opts := clock.TrajectoryOptions{Minutes: *minutes, Transitions: *transitions, UntilReturn: *untilReturn}
+	err := clock.New(uint8(*nBalls)).Trajectory(ctx, *id, opts, func(p clock.TrajectoryPoint) error {
+		return enc.Encode(p)
+	})
+	if err != nil && err != context.Canceled {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/bgmerrell/goballclock/clock"
+	"github.com/bgmerrell/goballclock/render"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Watch speeds, in clock minutes per second
+const DEFAULT_WATCH_SPEED = 10.0
+const MIN_WATCH_SPEED = 0.25
+const MAX_WATCH_SPEED = 10000.0
+
+const WATCH_KEYS = "keys: space pause/resume, s step, + faster, - slower, q quit"
+
+// Put the terminal into character-at-a-time mode without echo or signals,
+// so ^C arrives as a key and the terminal is always restored, returning a
+// function which restores the previous settings.  If stdin is not a
+// terminal, nothing is changed.
+func rawTerminal() func() {
+	stty := func(args ...string) (string, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return func() {}
+	}
+	stty("-icanon", "-echo", "-isig", "min", "1")
+	return func() { stty(saved) }
+}
+
+// Animate a clock in the terminal, one minute per frame, with keyboard
+// controls for pause, step and speed
+func watch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	nBalls := fs.Uint64("balls", clock.MIN_BALLS, "number of balls in the clock")
+	speed := fs.Float64("speed", DEFAULT_WATCH_SPEED, "clock minutes per second")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := clock.CheckBallCount(*nBalls); err != nil {
+		fmt.Fprintf(os.Stderr, "Malformed input (%s)\n", err.Error())
+		return err
+	}
+	if math.IsNaN(*speed) || *speed < MIN_WATCH_SPEED || *speed > MAX_WATCH_SPEED {
+		err := fmt.Errorf("Malformed input (speed must be in [%g, %g], got %g)",
+			MIN_WATCH_SPEED, MAX_WATCH_SPEED, *speed)
+		fmt.Fprintln(os.Stderr, err.Error())
+		return err
+	}
+
+	restore := rawTerminal()
+	defer restore()
+	keys := make(chan byte)
+	go func() {
+		r := bufio.NewReader(os.Stdin)
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- b
+		}
+	}()
+
+	c := clock.New(uint8(*nBalls))
+	paused := false
+	interval := func() time.Duration { return time.Duration(float64(time.Second) / *speed) }
+	draw := func() {
+		state := "running"
+		if paused {
+			state = "paused"
+		}
+		render.Terminal(os.Stdout, c, fmt.Sprintf("%s at %g minutes/second\n%s",
+			state, *speed, WATCH_KEYS))
+	}
+	draw()
+
+	ticker := time.NewTicker(interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !paused {
+				c.Step()
+				draw()
+			}
+		case key, ok := <-keys:
+			if !ok {
+				// stdin closed; keep animating without controls
+				keys = nil
+				continue
+			}
+			switch key {
+			case ' ', 'p':
+				paused = !paused
+			case 's', 'n':
+				paused = true
+				c.Step()
+			case '+', '=':
+				*speed = min(*speed*2, MAX_WATCH_SPEED)
+				ticker.Reset(interval())
+			case '-', '_':
+				*speed = max(*speed/2, MIN_WATCH_SPEED)
+				ticker.Reset(interval())
+			case 'q', 3: // 3 is ^C, which does not signal with -isig
+				return nil
+			}
+			draw()
+		}
+	}
+}